@@ -2,9 +2,11 @@ package gateway
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hwcer/gateway/errors"
 	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/token"
 
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosgo/values"
@@ -26,6 +28,10 @@ type accessSocket interface {
 	Socket() *cosnet.Socket
 }
 
+type accessProtocol interface {
+	Protocol() int8
+}
+
 type accessFunc func(r Proxy, req values.Metadata, isMaster bool) (*session.Data, error)
 
 type access struct {
@@ -40,7 +46,13 @@ func (this *access) Register(l gwcfg.OAuthType, f accessFunc) {
 }
 func (this *access) Verify(c Proxy, req values.Metadata, servicePath, serviceMethod string) (*session.Data, error) {
 	l, s := gwcfg.Authorize.Get(servicePath, serviceMethod)
+	if allow := gwcfg.Authorize.GetProtocol(s); !allow.Allow(this.Protocol(c)) {
+		return nil, errors.ErrProtocolDenied
+	}
 	isMaster := gwcfg.Authorize.IsMaster(s)
+	if isMaster && !gwcfg.IPFilter.Developer(c.RemoteAddr()) {
+		return nil, errors.ErrAddressDenied
+	}
 	f, ok := this.dict[l]
 	if !ok {
 		return nil, fmt.Errorf("unknown authorization type: %d", l)
@@ -49,6 +61,14 @@ func (this *access) Verify(c Proxy, req values.Metadata, servicePath, serviceMet
 	if err != nil {
 		return nil, err
 	}
+	if p != nil && !this.IsDeveloper(p) {
+		if err = gwcfg.Maintain.Verify(p.UUID(), c.RemoteAddr()); err != nil {
+			return nil, err
+		}
+	}
+	if permission := gwcfg.Authorize.GetPermission(s); permission != "" && !this.HasPermission(p, permission) {
+		return nil, errors.ErrPermissionDenied
+	}
 	req.Set(gwcfg.ServiceMetadataPermission, l)
 	return p, nil
 }
@@ -105,13 +125,59 @@ func (this *access) Player(r Proxy, req values.Metadata, needDeveloper bool) (p
 	return
 }
 
-// IsDeveloper 开发者模式
+// IsDeveloper 开发者模式,ServiceMetadataDeveloper 为开发者名称,旧版本为 1
 func (this *access) IsDeveloper(p *session.Data) bool {
 	if p == nil {
 		return false
 	}
-	if gm := p.GetInt32(gwcfg.ServiceMetadataDeveloper); gm == 1 {
+	if gm := p.GetString(gwcfg.ServiceMetadataDeveloper); gm != "" && gm != "0" {
 		return true
 	}
 	return false
 }
+
+// Protocol 请求使用的协议 gwcfg.ProtocolTypeXXX
+func (this *access) Protocol(c Proxy) int8 {
+	if f, ok := c.(accessProtocol); ok {
+		return f.Protocol()
+	}
+	return gwcfg.ProtocolTypeHTTP
+}
+
+// Roles session 中的角色
+func (this *access) Roles(p *session.Data) []string {
+	if p == nil {
+		return nil
+	}
+	return splitRoles(p.GetString(gwcfg.ServiceMetadataRole))
+}
+
+// splitRoles 逗号分隔的角色
+func splitRoles(s string) (r []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return
+}
+
+// HasPermission 是否拥有权限,需要角色拥有该权限或者 PermissionAll,没有角色时(包括开发者)没有权限
+func (this *access) HasPermission(p *session.Data, permission string) bool {
+	if p == nil {
+		return false
+	}
+	return gwcfg.Authorize.HasPermission(this.Roles(p), permission)
+}
+
+// Values 登录成功后写入 session 的身份信息,角色优先使用凭证中的 role,其次 attach.role
+func (this *access) Values(data *token.Result) values.Values {
+	vs := values.Values{}
+	vs.Set(gwcfg.ServiceMetadataDeveloper, data.DeveloperName())
+	role := data.Role
+	if role == "" && data.Attach != nil {
+		role, _ = data.Attach[gwcfg.ServiceMetadataRole].(string)
+	}
+	vs.Set(gwcfg.ServiceMetadataRole, role)
+	return vs
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestAccessHasPermission(t *testing.T) {
+	roles := gwcfg.Options.Roles
+	defer func() { gwcfg.Options.Roles = roles }()
+	gwcfg.Options.Roles = map[string][]string{"all": {gwcfg.PermissionAll}, "gm": {"gm.read"}}
+	cases := []struct {
+		name      string
+		developer string
+		role      string
+		ok        bool
+	}{
+		{"player", "", "", false},
+		{"shared developer", "1", "", false}, //没有角色的开发者没有权限
+		{"named developer", "alice", "", false},
+		{"role", "", "gm", true},
+		{"developer role", "alice", "gm", true},
+		{"all", "alice", "all", true},
+		{"other role", "alice", "qa", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := session.NewData("u1", values.Values{gwcfg.ServiceMetadataDeveloper: c.developer, gwcfg.ServiceMetadataRole: c.role})
+			if v := Access.HasPermission(p, "gm.read"); v != c.ok {
+				t.Fatalf("permission:%v want:%v", v, c.ok)
+			}
+		})
+	}
+	if Access.HasPermission(nil, "gm.read") {
+		t.Fatal("nil session has permission")
+	}
+}
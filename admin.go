@@ -0,0 +1,275 @@
+package gateway
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosweb"
+	"github.com/hwcer/gateway/channel"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+	"github.com/hwcer/gateway/token"
+	"github.com/hwcer/logger"
+)
+
+// 管理接口,注册在 HTTP 服务的 Setting.Admin 路由下
+// 使用开发者秘钥认证: Authorization: Bearer <secret>,开发者的角色需要拥有 AdminPermissionXXX 权限
+// 没有角色的开发者(包括共用秘钥 gwcfg.Options.Developer)不能使用,写操作需要角色明确拥有 AdminPermissionWrite
+
+const (
+	AdminPermissionRead  = "admin.read"  //查看玩家,会话,频道
+	AdminPermissionWrite = "admin.write" //踢人,广播
+)
+
+// AdminLimit 玩家列表每页最大数量
+var AdminLimit = 1000
+
+// AdminRecord 管理接口操作记录
+type AdminRecord struct {
+	Time      int64  `json:"time"`
+	Developer string `json:"developer"`
+	IP        string `json:"ip"`
+	Action    string `json:"action"`
+	Args      string `json:"args"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AdminAudit 操作记录,默认写入日志,可以替换成写入数据库
+var AdminAudit = func(r *AdminRecord) {
+	logger.Alert("管理接口,NAME:%s IP:%s ACTION:%s ARGS:%s ERROR:%s", r.Developer, r.IP, r.Action, r.Args, r.Error)
+}
+
+// AdminPlayer 在线玩家
+type AdminPlayer struct {
+	Guid      string `json:"guid"`
+	Uid       string `json:"uid,omitempty"`
+	Developer string `json:"dev,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Socket    uint64 `json:"socket,omitempty"` //长连接ID,短连接为0
+	IP        string `json:"ip,omitempty"`
+	Outbound  int    `json:"outbound,omitempty"` //积压的推送数量
+	Pending   int    `json:"pending,omitempty"`  //断线期间缓存的推送数量
+}
+
+// AdminSession 会话详情
+type AdminSession struct {
+	*AdminPlayer
+	Values   map[string]any    `json:"values"`
+	Channels map[string]string `json:"channels"` //已经加入的频道 name:value
+}
+
+// AdminChannel 频道
+type AdminChannel struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Fixed bool   `json:"fixed"`
+}
+
+type adminHandle func(c *cosweb.Context) (args any, reply any, err error)
+
+// adminRegister 注册管理接口
+func (this *HttpServer) adminRegister() {
+	this.adminRoute("players", AdminPermissionRead, this.adminPlayers)
+	this.adminRoute("session", AdminPermissionRead, this.adminSession)
+	this.adminRoute("channels", AdminPermissionRead, this.adminChannels)
+	this.adminRoute("connections", AdminPermissionRead, this.adminConnections)
+	this.adminRoute("outbound", AdminPermissionRead, this.adminOutbound)
+	this.adminRoute("kick", AdminPermissionWrite, this.adminKick)
+	this.adminRoute("broadcast", AdminPermissionWrite, this.adminBroadcast)
+}
+
+func (this *HttpServer) adminRoute(action, permission string, f adminHandle) {
+	route := path.Join("/", Setting.Admin, action)
+	this.Server.Register(route, func(c *cosweb.Context) any {
+		ip := gwcfg.RemoteIP(c.RemoteAddr())
+		record := &AdminRecord{Time: time.Now().Unix(), IP: ip, Action: action}
+		reply, err := this.adminCall(c, record, permission, f)
+		if err != nil {
+			record.Error = err.Error()
+		}
+		AdminAudit(record)
+		if err != nil {
+			return err
+		}
+		return reply
+	}, Method...)
+}
+
+func (this *HttpServer) adminCall(c *cosweb.Context, record *AdminRecord, permission string, f adminHandle) (any, error) {
+	secret := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+	d, err := token.DeveloperVerify(secret, record.IP)
+	if err != nil {
+		return nil, errors.ErrNeedGameDeveloper
+	}
+	record.Developer = d.Name
+	if !adminPermission(d, permission) {
+		return nil, errors.ErrPermissionDenied
+	}
+	args, reply, err := f(c)
+	if args != nil {
+		b, _ := json.Marshal(args)
+		record.Args = string(b)
+	}
+	return reply, err
+}
+
+// adminPermission 开发者是否拥有管理接口权限,没有角色时没有权限
+func adminPermission(d *gwcfg.Developer, permission string) bool {
+	if d.Role == "" {
+		return false
+	}
+	roles := splitRoles(d.Role)
+	if permission == AdminPermissionWrite {
+		return gwcfg.Authorize.HasExplicitPermission(roles, permission)
+	}
+	return gwcfg.Authorize.HasPermission(roles, permission)
+}
+
+func adminPlayer(p *session.Data) *AdminPlayer {
+	r := &AdminPlayer{
+		Guid:      p.UUID(),
+		Uid:       p.GetString(gwcfg.ServiceMetadataUID),
+		Developer: p.GetString(gwcfg.ServiceMetadataDeveloper),
+		Role:      p.GetString(gwcfg.ServiceMetadataRole),
+		Pending:   Pending.Len(p),
+	}
+	if sock := players.Socket(p); sock != nil {
+		r.Socket = sock.Id()
+		r.IP = SocketIP(sock)
+		r.Outbound, _ = Outbound.Len(sock)
+	}
+	return r
+}
+
+// adminPlayers 在线玩家列表,q 按 GUID 或 UID 模糊搜索,offset,limit 分页
+func (this *HttpServer) adminPlayers(c *cosweb.Context) (any, any, error) {
+	q := c.GetString("q", cosweb.RequestDataTypeQuery)
+	offset, _ := strconv.Atoi(c.GetString("offset", cosweb.RequestDataTypeQuery))
+	limit, _ := strconv.Atoi(c.GetString("limit", cosweb.RequestDataTypeQuery))
+	if limit <= 0 || limit > AdminLimit {
+		limit = 100
+	}
+	var list []*AdminPlayer
+	players.Range(func(p *session.Data) bool {
+		v := adminPlayer(p)
+		if q == "" || strings.Contains(v.Guid, q) || strings.Contains(v.Uid, q) {
+			list = append(list, v)
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Guid < list[j].Guid
+	})
+	total := len(list)
+	if offset < 0 || offset > total {
+		offset = total
+	}
+	list = list[offset:]
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	args := map[string]any{"q": q, "offset": offset, "limit": limit}
+	return args, map[string]any{"total": total, "list": list}, nil
+}
+
+// adminSession 会话详情,按 guid 或者 uid 查找
+func (this *HttpServer) adminSession(c *cosweb.Context) (any, any, error) {
+	guid := c.GetString("guid", cosweb.RequestDataTypeQuery)
+	uid := c.GetString("uid", cosweb.RequestDataTypeQuery)
+	args := map[string]string{"guid": guid, "uid": uid}
+	p := players.Find(guid, uid)
+	if p == nil {
+		return args, nil, values.Error("player not online")
+	}
+	r := &AdminSession{AdminPlayer: adminPlayer(p), Values: map[string]any{}, Channels: map[string]string{}}
+	p.Range(func(k string, v any) bool {
+		switch {
+		case k == players.SessionPlayerSocketName, k == SessionPlayerPendingName, k == SessionPlayerStreamName, k == SessionPlayerPollName:
+		case strings.HasPrefix(k, channel.PlayerChannelPrefix):
+			r.Channels[strings.TrimPrefix(k, channel.PlayerChannelPrefix)], _ = v.(string)
+		default:
+			r.Values[k] = v
+		}
+		return true
+	})
+	return args, r, nil
+}
+
+// adminChannels 频道列表,q 按频道名称前缀过滤
+func (this *HttpServer) adminChannels(c *cosweb.Context) (any, any, error) {
+	q := c.GetString("q", cosweb.RequestDataTypeQuery)
+	var list []*AdminChannel
+	channel.Channels(func(ch *channel.Channel) bool {
+		name, value := channel.Split(ch.Id())
+		if q == "" || strings.HasPrefix(name, q) {
+			list = append(list, &AdminChannel{Id: ch.Id(), Name: name, Value: value, Count: ch.Len(), Fixed: ch.Fixed()})
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return map[string]string{"q": q}, map[string]any{"total": len(list), "list": list}, nil
+}
+
+// adminConnections 长连接统计
+func (this *HttpServer) adminConnections(c *cosweb.Context) (any, any, error) {
+	return nil, Conns.Stats(), nil
+}
+
+// adminOutbound 推送积压统计
+func (this *HttpServer) adminOutbound(c *cosweb.Context) (any, any, error) {
+	return nil, Outbound.Stats(), nil
+}
+
+type adminKickArgs struct {
+	Guid string `json:"guid"`
+	Uid  string `json:"uid"`
+}
+
+// adminKick 踢下线,推送 S2CDisconnect(ErrKicked)
+func (this *HttpServer) adminKick(c *cosweb.Context) (any, any, error) {
+	args := &adminKickArgs{}
+	if err := c.Bind(args); err != nil {
+		return nil, nil, err
+	}
+	if args.Guid == "" && args.Uid == "" {
+		return args, nil, values.Error("guid and uid empty")
+	}
+	online := Kick(players.Find(args.Guid, args.Uid), errors.ErrKicked)
+	return args, map[string]bool{"online": online}, nil
+}
+
+type adminBroadcastArgs struct {
+	Path   string `json:"path"`
+	Body   string `json:"body"`
+	Ignore string `json:"ignore"` //忽略的UID,逗号分隔
+}
+
+// adminBroadcast 全服广播
+func (this *HttpServer) adminBroadcast(c *cosweb.Context) (any, any, error) {
+	args := &adminBroadcastArgs{}
+	if err := c.Bind(args); err != nil {
+		return nil, nil, err
+	}
+	if args.Path == "" {
+		return args, nil, values.Error("path empty")
+	}
+	mate := values.Metadata{gwcfg.ServiceMessagePath: args.Path}
+	if args.Ignore != "" {
+		mate[gwcfg.ServiceMessageIgnore] = args.Ignore
+	}
+	if err := Broadcast(mate, []byte(args.Body)); err != nil {
+		return args, nil, err
+	}
+	return args, true, nil
+}
@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestAdminPermission(t *testing.T) {
+	roles := gwcfg.Options.Roles
+	defer func() { gwcfg.Options.Roles = roles }()
+	gwcfg.Options.Roles = map[string][]string{
+		"all":    {gwcfg.PermissionAll},
+		"viewer": {AdminPermissionRead},
+		"ops":    {AdminPermissionRead, AdminPermissionWrite},
+	}
+	cases := []struct {
+		role  string
+		read  bool
+		write bool
+	}{
+		{"", false, false}, //没有角色,包括共用秘钥
+		{"unknown", false, false},
+		{"all", true, false}, //* 不授予写权限
+		{"viewer", true, false},
+		{"ops", true, true},
+		{"viewer,ops", true, true},
+	}
+	for _, c := range cases {
+		d := &gwcfg.Developer{Name: "dev", Role: c.role}
+		if v := adminPermission(d, AdminPermissionRead); v != c.read {
+			t.Errorf("role %q read:%v want:%v", c.role, v, c.read)
+		}
+		if v := adminPermission(d, AdminPermissionWrite); v != c.write {
+			t.Errorf("role %q write:%v want:%v", c.role, v, c.write)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+)
+
+// 异步广播,广播进入有限长度的队列后立即返回,遍历一次在线玩家后按 GUID 分片交给多个协程并行推送
+// 同一个玩家始终由同一个协程推送,保证广播顺序; 队列满时等待 Broadcast.Timeout 后返回 ErrBroadcastBusy
+
+var Broadcaster = &broadcaster{}
+
+// BroadcastResult 广播结果,metadata 中有 _msg_wait 时返回
+type BroadcastResult struct {
+	Delivered int64 `json:"delivered"` //已经推送
+	Offline   int64 `json:"offline"`   //长连接已断开
+	Filtered  int64 `json:"filtered"`  //被 ignore 或者过滤条件排除
+	Done      bool  `json:"done"`      //是否推送完成,等待超时时为 false
+}
+
+type broadcastJob struct {
+	message *outboundMessage
+	ignore  map[string]struct{}
+	filter  gwcfg.Filter
+	wg      sync.WaitGroup
+	result  struct {
+		delivered atomic.Int64
+		offline   atomic.Int64
+		filtered  atomic.Int64
+	}
+}
+
+// accept 是否需要推送,被 ignore 或者过滤条件排除时计数
+func (this *broadcastJob) accept(p *session.Data) bool {
+	if _, ok := this.ignore[p.GetString(gwcfg.ServiceMetadataUID)]; ok {
+		this.result.filtered.Add(1)
+		return false
+	}
+	if this.filter != nil && !this.filter.Match(p) {
+		this.result.filtered.Add(1)
+		return false
+	}
+	return true
+}
+
+func (this *broadcastJob) push(p *session.Data) {
+	if pushPlayer(p, players.Socket(p), this.message) {
+		this.result.delivered.Add(1)
+	} else {
+		this.result.offline.Add(1)
+	}
+}
+
+// run 没有启动协程时在当前协程推送
+func (this *broadcastJob) run() {
+	defer this.wg.Done()
+	players.Range(func(p *session.Data) bool {
+		if this.accept(p) {
+			this.push(p)
+		}
+		return true
+	})
+}
+
+// wait 等待推送完成,最多等待 timeout
+func (this *broadcastJob) wait(timeout time.Duration) *BroadcastResult {
+	done := make(chan struct{})
+	go func() {
+		this.wg.Wait()
+		close(done)
+	}()
+	r := &BroadcastResult{}
+	select {
+	case <-done:
+		r.Done = true
+	case <-time.After(timeout):
+	}
+	r.Delivered = this.result.delivered.Load()
+	r.Offline = this.result.offline.Load()
+	r.Filtered = this.result.filtered.Load()
+	return r
+}
+
+func broadcastShard(guid string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(guid))
+	return int(h.Sum32() % uint32(n))
+}
+
+// broadcastWorkerQueue 每个推送协程等待推送的玩家数量,满时分发阻塞
+const broadcastWorkerQueue = 1024
+
+type broadcastTask struct {
+	job *broadcastJob
+	p   *session.Data
+}
+
+type broadcaster struct {
+	jobs    chan *broadcastJob
+	workers []chan broadcastTask
+	started atomic.Bool
+}
+
+func (this *broadcaster) start() {
+	opts := gwcfg.Options.Broadcast
+	if opts == nil {
+		opts = &gwcfg.Broadcast{}
+	}
+	n := opts.Workers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	this.jobs = make(chan *broadcastJob, max(opts.Queue, 1))
+	this.workers = make([]chan broadcastTask, n)
+	for i := range this.workers {
+		ch := make(chan broadcastTask, broadcastWorkerQueue)
+		this.workers[i] = ch
+		background.Go(func(ctx context.Context) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-ch:
+					task.job.push(task.p)
+					task.job.wg.Done()
+				}
+			}
+		})
+	}
+	background.Go(this.dispatch)
+	this.started.Store(true)
+}
+
+// dispatch 按顺序处理广播,每个广播只遍历一次在线玩家,按 GUID 分发给对应的协程,协程繁忙时阻塞,队列随之积压
+func (this *broadcaster) dispatch(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-this.jobs:
+			if !this.split(ctx, job) {
+				return
+			}
+		}
+	}
+}
+
+// split 遍历在线玩家并分发,ctx 结束时返回 false
+func (this *broadcaster) split(ctx context.Context, job *broadcastJob) (ok bool) {
+	defer job.wg.Done()
+	ok = true
+	n := len(this.workers)
+	players.Range(func(p *session.Data) bool {
+		if !job.accept(p) {
+			return true
+		}
+		job.wg.Add(1)
+		select {
+		case this.workers[broadcastShard(p.UUID(), n)] <- broadcastTask{job: job, p: p}:
+		case <-ctx.Done():
+			job.wg.Done()
+			ok = false
+		}
+		return ok
+	})
+	return
+}
+
+// Len 队列中等待推送的广播数量
+func (this *broadcaster) Len() int {
+	return len(this.jobs)
+}
+
+// push 加入队列,没有启动时直接推送
+func (this *broadcaster) push(job *broadcastJob) error {
+	job.wg.Add(1)
+	if !this.started.Load() {
+		job.run()
+		return nil
+	}
+	timeout := time.Second
+	if opts := gwcfg.Options.Broadcast; opts != nil && opts.Timeout > 0 {
+		timeout = time.Duration(opts.Timeout) * time.Millisecond
+	}
+	select {
+	case this.jobs <- job:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case this.jobs <- job:
+		return nil
+	case <-timer.C:
+		return errors.ErrBroadcastBusy
+	}
+}
+
+// waitTimeout 等待广播完成的最长时间
+func (this *broadcaster) waitTimeout() time.Duration {
+	if opts := gwcfg.Options.Broadcast; opts != nil && opts.Wait > 0 {
+		return time.Duration(opts.Wait) * time.Second
+	}
+	return 10 * time.Second
+}
@@ -15,10 +15,8 @@ import (
 func init() {
 	Register(&channelHandle{}, "channel", "%m")
 	channel.SendMessage = func(p *session.Data, path string, data []byte) {
-		if sock := players.Socket(p); sock != nil {
-			flag := message.FlagBroadcast
-			_ = sock.Send(flag, 0, path, data)
-		}
+		flag := message.FlagBroadcast
+		pushPlayer(p, players.Socket(p), newOutboundMessage(flag, 0, path, data, nil))
 	}
 }
 
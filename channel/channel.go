@@ -32,6 +32,18 @@ func (this *Channel) Id() string {
 	return this.id
 }
 
+// Len 频道人数
+func (this *Channel) Len() int {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return len(this.ps)
+}
+
+// Fixed 是否固定频道
+func (this *Channel) Fixed() bool {
+	return this.fixed
+}
+
 func (this *Channel) Join(d *session.Data) bool {
 	// 快速路径检查：使用读锁检查玩家是否已经在频道中
 	this.locker.RLock()
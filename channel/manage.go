@@ -76,6 +76,16 @@ func Range(name, value string, f func(*session.Data) bool) {
 	room.Range(f)
 }
 
+// Channels 遍历所有频道
+func Channels(f func(*Channel) bool) {
+	manage.Range(func(_, v any) bool {
+		if c, ok := v.(*Channel); ok {
+			return f(c)
+		}
+		return true
+	})
+}
+
 // Release 用户掉线,销毁时 清理所在房间信息
 func Release(p *session.Data) {
 	setter := NewSetter(p)
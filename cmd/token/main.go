@@ -0,0 +1,57 @@
+// 生成网关登录凭证(access),用于压测和本地测试
+//
+//	go run ./cmd/token -appid gate -secret xxx -openid test -expire 24h -attach '{"sid":1}'
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/token"
+)
+
+var (
+	appid     = flag.String("appid", "", "游戏ID,必须与网关 appid 一致")
+	secret    = flag.String("secret", "", "平台秘钥,网关配置中的 secret 或者 secrets.secret")
+	kid       = flag.String("kid", "", "秘钥ID,对应网关配置中的 secrets.id,为空时生成旧版本凭证")
+	openid    = flag.String("openid", "", "账号ID")
+	expire    = flag.Duration("expire", 0, "有效期,例如 1h,0 表示永不过期")
+	attach    = flag.String("attach", "", "透传给游戏服的附加信息,JSON 对象")
+	developer = flag.Bool("developer", false, "是否开发者账号")
+	nonce     = flag.String("nonce", "", "凭证唯一ID,网关开启防重放时同一凭证只能使用一次")
+)
+
+func main() {
+	flag.Parse()
+	r := token.Result{Appid: *appid, Openid: *openid, Developer: *developer, Nonce: *nonce}
+	if *expire > 0 {
+		r.Expire = time.Now().Add(*expire).Unix()
+	}
+	if *attach != "" {
+		r.Attach = values.Values{}
+		if err := json.Unmarshal([]byte(*attach), &r.Attach); err != nil {
+			exit(fmt.Errorf("attach 格式错误:%v", err))
+		}
+	}
+	var s string
+	var err error
+	if *kid != "" {
+		s, err = token.IssueWithKey(r, *kid, *secret)
+	} else {
+		s, err = token.Issue(r, *secret)
+	}
+	if err != nil {
+		exit(err)
+	}
+	fmt.Println(s)
+}
+
+func exit(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, err)
+	flag.Usage()
+	os.Exit(1)
+}
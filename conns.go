@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// 长连接(TCP/WSS)连接数和消息频率限制,配置 gwcfg.Options.Connect,实时生效
+
+var Conns = &conns{ip: map[string]int{}, dict: map[uint64]*connState{}}
+
+// ConnsRecent 保留最近被限制的记录数量
+var ConnsRecent = 100
+
+// ConnsTop 统计中按连接数列出的IP数量
+var ConnsTop = 20
+
+type connState struct {
+	ip       string
+	tokens   float64
+	last     time.Time
+	messages uint64
+}
+
+// ConnThrottle 被限制的记录
+type ConnThrottle struct {
+	Time   int64  `json:"time"`
+	IP     string `json:"ip"`
+	Socket uint64 `json:"socket"` //连接数超出时为新连接ID,WSS握手阶段为0
+	Reason int32  `json:"reason"` //错误码 errors.ErrTooManyXXX
+}
+
+// ConnIP 单个IP的连接数
+type ConnIP struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+}
+
+// ConnStats 连接统计
+type ConnStats struct {
+	Total     int             `json:"total"`     //当前连接数
+	Rejected  uint64          `json:"rejected"`  //连接数超出拒绝的次数
+	Throttled uint64          `json:"throttled"` //消息频率超出断开的次数
+	Top       []ConnIP        `json:"top"`       //连接数最多的IP
+	Recent    []*ConnThrottle `json:"recent"`    //最近被限制的记录,最新的在前
+	Options   gwcfg.Connect   `json:"options"`
+}
+
+type conns struct {
+	total     int
+	ip        map[string]int
+	dict      map[uint64]*connState
+	rejected  uint64
+	throttled uint64
+	recent    []*ConnThrottle
+	locker    sync.Mutex
+}
+
+func (this *conns) options() gwcfg.Connect {
+	if c := gwcfg.Options.Connect; c != nil {
+		return *c
+	}
+	return gwcfg.Connect{}
+}
+
+// allow 是否允许 ip 建立新连接,需要加锁
+func (this *conns) allow(opts gwcfg.Connect, ip string) bool {
+	if opts.Max > 0 && this.total >= opts.Max {
+		return false
+	}
+	if opts.IP > 0 && this.ip[ip] >= opts.IP {
+		return false
+	}
+	return true
+}
+
+// Allow WSS 握手时检查,不占用连接数
+func (this *conns) Allow(ip string) bool {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.allow(this.options(), ip) {
+		return true
+	}
+	this.rejected++
+	this.record(0, ip, errors.ErrTooManyConnections.Code)
+	return false
+}
+
+// Connect 记录新连接,超出限制时返回 errors.ErrTooManyConnections
+func (this *conns) Connect(sock *cosnet.Socket) error {
+	ip := SocketIP(sock)
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	opts := this.options()
+	if !this.allow(opts, ip) {
+		this.rejected++
+		this.record(sock.Id(), ip, errors.ErrTooManyConnections.Code)
+		logger.Debug("连接数超出限制,IP:%s 总数:%d IP连接数:%d", ip, this.total, this.ip[ip])
+		return errors.ErrTooManyConnections
+	}
+	this.total++
+	this.ip[ip]++
+	this.dict[sock.Id()] = &connState{ip: ip, tokens: opts.Capacity(), last: time.Now()}
+	return nil
+}
+
+// Disconnect 连接断开,释放连接数
+func (this *conns) Disconnect(sock *cosnet.Socket) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	s, ok := this.dict[sock.Id()]
+	if !ok {
+		return
+	}
+	delete(this.dict, sock.Id())
+	this.total--
+	if n := this.ip[s.ip] - 1; n > 0 {
+		this.ip[s.ip] = n
+	} else {
+		delete(this.ip, s.ip)
+	}
+}
+
+// Message 收到消息时消耗一个令牌,超出时返回 errors.ErrTooManyMessages
+func (this *conns) Message(sock *cosnet.Socket) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	s, ok := this.dict[sock.Id()]
+	if !ok {
+		return nil
+	}
+	s.messages++
+	opts := this.options()
+	if opts.Rate <= 0 {
+		return nil
+	}
+	now := time.Now()
+	capacity := opts.Capacity()
+	s.tokens += now.Sub(s.last).Seconds() * opts.Rate
+	s.last = now
+	if s.tokens > capacity {
+		s.tokens = capacity
+	}
+	if s.tokens < 1 {
+		this.throttled++
+		this.record(sock.Id(), s.ip, errors.ErrTooManyMessages.Code)
+		logger.Debug("消息频率超出限制,Socket:%d IP:%s 消息数:%d", sock.Id(), s.ip, s.messages)
+		return errors.ErrTooManyMessages
+	}
+	s.tokens--
+	return nil
+}
+
+func (this *conns) record(id uint64, ip string, reason int32) {
+	if ConnsRecent <= 0 {
+		return
+	}
+	this.recent = append(this.recent, &ConnThrottle{Time: time.Now().Unix(), IP: ip, Socket: id, Reason: reason})
+	if n := len(this.recent) - ConnsRecent; n > 0 {
+		this.recent = append(this.recent[:0], this.recent[n:]...)
+	}
+}
+
+// Stats 连接统计
+func (this *conns) Stats() *ConnStats {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	r := &ConnStats{Total: this.total, Rejected: this.rejected, Throttled: this.throttled, Options: this.options()}
+	for ip, n := range this.ip {
+		r.Top = append(r.Top, ConnIP{IP: ip, Count: n})
+	}
+	sort.Slice(r.Top, func(i, j int) bool {
+		if r.Top[i].Count != r.Top[j].Count {
+			return r.Top[i].Count > r.Top[j].Count
+		}
+		return r.Top[i].IP < r.Top[j].IP
+	})
+	if len(r.Top) > ConnsTop {
+		r.Top = r.Top[:ConnsTop]
+	}
+	for i := len(this.recent) - 1; i >= 0; i-- {
+		r.Recent = append(r.Recent, this.recent[i])
+	}
+	return r
+}
+
+// Range 遍历当前所有长连接,f 在锁外执行
+func (this *conns) Range(f func(sock *cosnet.Socket)) {
+	this.locker.Lock()
+	ids := make([]uint64, 0, len(this.dict))
+	for id := range this.dict {
+		ids = append(ids, id)
+	}
+	this.locker.Unlock()
+	for _, id := range ids {
+		if sock := TCP.Sockets.Get(id); sock != nil {
+			f(sock)
+		}
+	}
+}
+
+// SocketIP 长连接客户端IP
+func SocketIP(sock *cosnet.Socket) string {
+	addr := sock.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	return gwcfg.RemoteIP(addr.String())
+}
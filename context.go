@@ -32,6 +32,15 @@ func NewContextWithSocket(path string, flag *message.Flag, meta values.Metadata,
 	}
 	return &r
 }
+
+// NewContextWithSession 推送给玩家时使用,长连接可能已经断开(socket==nil)
+func NewContextWithSession(path string, flag *message.Flag, meta values.Metadata, data *session.Data, socket *cosnet.Socket) *Context {
+	r := Context{path: path, flag: flag, meta: meta, data: data}
+	if socket != nil {
+		r.address = socket.RemoteAddr().String()
+	}
+	return &r
+}
 func NewContextWithProxy(path string, flag *message.Flag, meta values.Metadata, ctx Proxy) *Context {
 	r := Context{path: path, flag: flag, meta: meta}
 	r.data = ctx.Session()
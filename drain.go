@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/scc"
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/channel"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+	"github.com/hwcer/logger"
+)
+
+// 平滑关闭,Module.Close 时执行:
+// 关闭监听,停止接受新连接和新请求 -> 推送重启通知 -> 等待进行中的请求 -> 关闭连接 -> 释放玩家会话 -> 结束后台协程
+// 除关闭监听外都在后台执行,不阻塞 Module.Close
+
+var Drain = newDrainer()
+
+type drainer struct {
+	draining  atomic.Bool
+	inflight  atomic.Int64
+	idle      chan struct{} //关闭期间请求全部结束时通知
+	done      chan struct{} //关闭完成
+	locker    sync.Mutex
+	listeners []io.Closer
+}
+
+func newDrainer() *drainer {
+	return &drainer{idle: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// Draining 是否正在关闭,健康检查返回 draining
+func (this *drainer) Draining() bool {
+	return this.draining.Load()
+}
+
+// Inflight 进行中的代理请求数量
+func (this *drainer) Inflight() int64 {
+	return this.inflight.Load()
+}
+
+// Add 开始一个代理请求,正在关闭时返回 false
+func (this *drainer) Add() bool {
+	if this.draining.Load() {
+		return false
+	}
+	this.inflight.Add(1)
+	if this.draining.Load() {
+		this.Done()
+		return false
+	}
+	return true
+}
+
+// Done 代理请求结束
+func (this *drainer) Done() {
+	if this.inflight.Add(-1) == 0 && this.draining.Load() {
+		select {
+		case this.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Error 带重启通知的 ErrServerRestarting
+func (this *drainer) Error() error {
+	if opts := gwcfg.Options.Drain; opts != nil && opts.Notice != "" {
+		return &values.Message{Code: errors.ErrServerRestarting.Code, Data: opts.Notice}
+	}
+	return errors.ErrServerRestarting
+}
+
+// listen 记录监听器,关闭时首先关闭,已经开始关闭时立即关闭
+func (this *drainer) listen(ln io.Closer) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.draining.Load() {
+		_ = ln.Close()
+		return
+	}
+	this.listeners = append(this.listeners, ln)
+}
+
+// Shutdown 开始关闭,关闭所有监听器后立即返回,其余步骤在后台执行
+// 返回的 channel 在关闭完成时关闭,重复调用时返回同一个 channel
+func (this *drainer) Shutdown() <-chan struct{} {
+	if !this.draining.CompareAndSwap(false, true) {
+		return this.done
+	}
+	this.locker.Lock()
+	listeners := this.listeners
+	this.listeners = nil
+	this.locker.Unlock()
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+	opts := gwcfg.Options.Drain
+	if opts == nil {
+		opts = &gwcfg.Drain{}
+	}
+	logger.Alert("网关开始关闭,连接数:%d 进行中的请求:%d", Conns.Stats().Total, this.Inflight())
+	go this.shutdown(opts)
+	return this.done
+}
+
+func (this *drainer) shutdown(opts *gwcfg.Drain) {
+	defer close(this.done)
+	if opts.Delay > 0 {
+		time.Sleep(time.Duration(opts.Delay) * time.Second) //等待负载均衡通过健康检查摘除
+	}
+	reason := this.Error()
+	Conns.Range(func(sock *cosnet.Socket) {
+		TCP.S2CDisconnect(sock, reason)
+	})
+	if !this.wait(time.Duration(opts.Timeout) * time.Second) {
+		logger.Alert("网关关闭等待超时,未完成的请求:%d", this.Inflight())
+	}
+	Conns.Range(func(sock *cosnet.Socket) {
+		sock.Close()
+	})
+	var n int
+	players.Range(func(p *session.Data) bool {
+		players.Delete(p)
+		channel.Release(p)
+		n++
+		return true
+	})
+	Broadcaster.started.Store(false) //之后的广播在当前协程推送
+	background.Stop()
+	logger.Alert("网关关闭完成,释放玩家:%d", n)
+}
+
+// wait 等待进行中的请求全部结束,超时返回 false
+func (this *drainer) wait(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for this.Inflight() > 0 {
+		select {
+		case <-this.idle:
+		case <-timer.C:
+			return false
+		}
+	}
+	return true
+}
+
+// background Module.Start 启动的后台协程(广播,推送积压,维护计划),关闭完成或者框架关闭时结束
+var background = &workerGroup{done: make(chan struct{})}
+
+type workerGroup struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// Go 启动后台协程,ctx 在 Stop 或者框架关闭时结束
+func (this *workerGroup) Go(f func(ctx context.Context)) {
+	scc.CGO(func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-this.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		f(ctx)
+	})
+}
+
+// Stop 结束所有后台协程
+func (this *workerGroup) Stop() {
+	this.once.Do(func() { close(this.done) })
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+type drainListener struct {
+	closed atomic.Bool
+}
+
+func (this *drainListener) Close() error {
+	this.closed.Store(true)
+	return nil
+}
+
+func TestDrainShutdown(t *testing.T) {
+	opts := gwcfg.Options.Drain
+	t.Cleanup(func() { gwcfg.Options.Drain = opts })
+	gwcfg.Options.Drain = &gwcfg.Drain{Timeout: 5}
+	d := newDrainer()
+	ln := &drainListener{}
+	d.listen(ln)
+	if !d.Add() || d.Inflight() != 1 {
+		t.Fatalf("add inflight:%d", d.Inflight())
+	}
+	start := time.Now()
+	done := d.Shutdown()
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatal("shutdown should not block")
+	}
+	// 首先关闭监听器,之后的请求和监听器立即拒绝
+	if !d.Draining() || !ln.closed.Load() {
+		t.Fatal("listener not closed")
+	}
+	if d.Add() || d.Inflight() != 1 {
+		t.Fatalf("add while draining inflight:%d", d.Inflight())
+	}
+	late := &drainListener{}
+	if d.listen(late); !late.closed.Load() {
+		t.Fatal("listener added while draining not closed")
+	}
+	select {
+	case <-done:
+		t.Fatal("shutdown finished with inflight request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 请求结束后不需要等待 Timeout
+	d.Done()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown not finished after requests done")
+	}
+	if d.Shutdown() != done {
+		t.Fatal("repeated shutdown should return the same channel")
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	opts := gwcfg.Options.Drain
+	t.Cleanup(func() { gwcfg.Options.Drain = opts })
+	gwcfg.Options.Drain = &gwcfg.Drain{Timeout: 1}
+	d := newDrainer()
+	d.Add()
+	start := time.Now()
+	select {
+	case <-d.Shutdown():
+	case <-time.After(3 * time.Second):
+		t.Fatal("shutdown timeout not applied")
+	}
+	if cost := time.Since(start); cost < 900*time.Millisecond {
+		t.Fatalf("shutdown finished before timeout:%v", cost)
+	}
+}
@@ -3,8 +3,19 @@ package errors
 import "github.com/hwcer/cosgo/values"
 
 var (
-	ErrNotFount          = values.Errorf(404, "page not found")
-	ErrNotSelectRole     = values.Errorf(405, "not select role")                  //请先选择角色
-	ErrNeedGameDeveloper = values.Errorf(406, "developer permission is required") //需要GM权限
-	ErrServerMaintenance = values.Errorf(407, "server maintenance in progress")   //维护模式
+	ErrNotFount           = values.Errorf(404, "page not found")
+	ErrNotSelectRole      = values.Errorf(405, "not select role")                  //请先选择角色
+	ErrNeedGameDeveloper  = values.Errorf(406, "developer permission is required") //需要GM权限
+	ErrServerMaintenance  = values.Errorf(407, "server maintenance in progress")   //维护模式
+	ErrAccessReplay       = values.Errorf(408, "access token already used")        //登录凭证重复使用
+	ErrPermissionDenied   = values.Errorf(409, "permission denied")                //角色没有接口权限
+	ErrProtocolDenied     = values.Errorf(410, "protocol not allowed")             //接口不允许使用当前协议
+	ErrTooManyRequests    = values.Errorf(411, "too many requests")                //接口调用过于频繁
+	ErrTooManyConnections = values.Errorf(412, "too many connections")             //连接数超出限制
+	ErrTooManyMessages    = values.Errorf(413, "too many messages")                //消息频率超出限制,连接被断开
+	ErrAddressDenied      = values.Errorf(414, "address not allowed")              //IP不允许访问
+	ErrServerRestarting   = values.Errorf(415, "server restarting")                //网关正在关闭,请重新连接
+	ErrKicked             = values.Errorf(416, "kicked")                           //被踢下线
+	ErrBroadcastBusy      = values.Errorf(417, "broadcast queue full")             //广播队列已满,请稍后重试
+	ErrSlowConsumer       = values.Errorf(418, "outbound queue full")              //推送积压超出限制,连接被断开
 )
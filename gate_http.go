@@ -10,7 +10,6 @@ import (
 
 	"github.com/hwcer/cosgo"
 	"github.com/hwcer/cosnet/message"
-	"github.com/hwcer/cosrpc"
 	"github.com/hwcer/coswss"
 	"github.com/hwcer/gateway/gwcfg"
 	"github.com/hwcer/gateway/players"
@@ -31,7 +30,7 @@ var Method = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 var Headers = []string{
 	session.Options.Name,
 	"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization",
-	"X-CSRF-Token", "X-Requested-With", "X-Unity-Version", "x-Forwarded-Key", "x-Forwarded-Val",
+	"X-CSRF-Token", "X-Requested-With", "X-Unity-Version", "x-Forwarded-Key", "x-Forwarded-Val", "Last-Event-ID",
 }
 
 // NewHttpServer 创建HTTP服务器实例
@@ -61,8 +60,9 @@ func (this *HttpServer) init() (err error) {
 	allow.Methods(Method...)
 	allow.Headers(Headers...)
 	this.Server.Use(allow.Middleware)
+	this.Server.Use(this.acl)
 
-	for k := range cosrpc.Service {
+	for _, k := range Setting.Services() {
 		this.Server.Register(fmt.Sprintf("/%s/*", k), this.proxy, Method...)
 	}
 
@@ -76,6 +76,15 @@ func (this *HttpServer) init() (err error) {
 	if Setting.C2SHeartbeat != "" {
 		this.Server.Register(Setting.C2SHeartbeat, this.C2SHeartbeat, Method...) // 注册心跳服务
 	}
+	if Setting.Health != "" {
+		this.Server.Register(Setting.Health, this.health, Method...) // 健康检查
+	}
+	if Setting.Poll != "" {
+		this.Server.Register(Setting.Poll, this.poll, http.MethodGet, http.MethodPost) // HTTP 推送
+	}
+	if Setting.Admin != "" {
+		this.adminRegister() // 管理接口
+	}
 
 	// 静态文件服务
 	if gwcfg.Options.Gate.Static != nil && gwcfg.Options.Gate.Static.Root != "" {
@@ -89,6 +98,16 @@ func (this *HttpServer) init() (err error) {
 	}
 	return nil
 }
+
+// acl 检查 gwcfg.IPFilter,不允许的IP返回 403
+func (this *HttpServer) acl(c *cosweb.Context, next cosweb.Next) error {
+	if ip := gwcfg.RemoteIP(c.RemoteAddr()); !gwcfg.IPFilter.Allow(ip) {
+		logger.Debug("IP禁止访问,IP:%s PATH:%s", ip, c.Request.URL.Path)
+		c.Response.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	return next()
+}
 func (this *HttpServer) WebSocket(c *cosweb.Context, next cosweb.Next) error {
 	if !coswss.IsWebSocket(c.Request) {
 		return next()
@@ -122,15 +141,11 @@ func (this *HttpServer) serialize(c *cosweb.Context, reply any) ([]byte, error)
 // 返回值:
 //   - error: 监听过程中的错误
 func (this *HttpServer) Listen(address string) (err error) {
-	if gwcfg.Options.Gate.KeyFile != "" && gwcfg.Options.Gate.CertFile != "" {
-		err = this.Server.TLS(address, gwcfg.Options.Gate.CertFile, gwcfg.Options.Gate.KeyFile)
-	} else {
-		err = this.Server.Listen(address)
-	}
-	if err == nil {
-		logger.Trace("网关短连接启动：%v", gwcfg.Options.Gate.Address)
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
 	}
-	return
+	return this.Accept(ln)
 }
 
 // Accept 接受HTTP连接
@@ -140,6 +155,7 @@ func (this *HttpServer) Listen(address string) (err error) {
 // 返回值:
 //   - error: 接受连接过程中的错误
 func (this *HttpServer) Accept(ln net.Listener) (err error) {
+	Drain.listen(ln)
 	if gwcfg.Options.Gate.KeyFile != "" && gwcfg.Options.Gate.CertFile != "" {
 		err = this.Server.TLS(ln, gwcfg.Options.Gate.CertFile, gwcfg.Options.Gate.KeyFile)
 	} else {
@@ -163,18 +179,13 @@ func (this *HttpServer) oauth(c *cosweb.Context) any {
 		return err
 	}
 	// 验证 token
-	data, err := token.Verify(args)
+	ctx := HttpContent{Context: c}
+	data, err := token.VerifyWithIP(args, ctx.RemoteAddr())
 	if err != nil {
 		return err
 	}
 	// 创建 http 代理并登录
-	ctx := HttpContent{Context: c}
-	vs := values.Values{}
-	if data.Developer {
-		vs.Set(gwcfg.ServiceMetadataDeveloper, "1")
-	} else {
-		vs.Set(gwcfg.ServiceMetadataDeveloper, "")
-	}
+	vs := Access.Values(data)
 
 	// 构建响应
 	cookie := map[string]string{}
@@ -182,6 +193,9 @@ func (this *HttpServer) oauth(c *cosweb.Context) any {
 	if cookie["val"], err = ctx.Login(data.Openid, vs); err != nil {
 		return err
 	}
+	if p := players.Get(data.Openid); p != nil {
+		Stream.Login(p, nil, token.ArgsReliableOf(args))
+	}
 	if Setting.G2SOAuth == "" {
 		return cookie
 	}
@@ -207,6 +221,15 @@ func (this *HttpServer) C2SHeartbeat(c *cosweb.Context) any {
 	return time.Now().UnixMilli()
 }
 
+// health 健康检查,正在关闭时返回 503 draining
+func (this *HttpServer) health(c *cosweb.Context) any {
+	if Drain.Draining() {
+		c.Response.WriteHeader(http.StatusServiceUnavailable)
+		return HealthDraining
+	}
+	return HealthOK
+}
+
 // proxy 处理HTTP请求代理
 // 参数:
 //   - c: cosweb上下文
@@ -348,16 +371,17 @@ func (this *HttpContent) Metadata() values.Metadata {
 // 返回值:
 //   - string: 远程地址
 func (this *HttpContent) RemoteAddr() string {
-	ip := this.Context.RemoteAddr()
-	if i := strings.Index(ip, ":"); i > 0 {
-		ip = ip[0:i]
-	}
-	return ip
+	return gwcfg.RemoteIP(this.Context.RemoteAddr())
 }
 func (this *HttpContent) Flag() message.Flag {
 	return 0
 }
 
+// Protocol 请求使用的协议
+func (this *HttpContent) Protocol() int8 {
+	return gwcfg.ProtocolTypeHTTP
+}
+
 // getContentType 获取内容类型
 // 从请求头中获取指定的内容类型
 // 参数:
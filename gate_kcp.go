@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"net"
+
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/cosnet/tcp"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+	"github.com/xtaci/kcp-go"
+)
+
+// KCP 长连接,连接交给 TCP.Sockets 处理,认证,重连,心跳,推送和频道与 TCP 相同
+// 使用 gwcfg.Options.Gate.KCP 中的参数,修改后需要重启
+
+// ListenKCP 监听UDP端口
+// 参数:
+//   - address: 监听地址
+//
+// 返回值:
+//   - error: 监听过程中的错误
+func (this *TcpServer) ListenKCP(address string) error {
+	opts := gwcfg.Options.Gate.KCP
+	if opts == nil {
+		opts = &gwcfg.KCP{}
+	}
+	ln, err := kcp.ListenWithOptions(address, nil, opts.DataShards, opts.ParityShards)
+	if err != nil {
+		return err
+	}
+	if opts.ReadBuffer > 0 {
+		if err = ln.SetReadBuffer(opts.ReadBuffer); err != nil {
+			logger.Alert("KCP SetReadBuffer error:%v", err)
+		}
+	}
+	if opts.WriteBuffer > 0 {
+		if err = ln.SetWriteBuffer(opts.WriteBuffer); err != nil {
+			logger.Alert("KCP SetWriteBuffer error:%v", err)
+		}
+	}
+	Drain.listen(ln)
+	this.Sockets.Accept(&tcp.Listener{Listener: &kcpListener{Listener: ln, options: opts}})
+	logger.Trace("网关KCP启动：%v", address)
+	return nil
+}
+
+// kcpListener 为每个 KCP 会话设置参数
+type kcpListener struct {
+	*kcp.Listener
+	options *gwcfg.KCP
+}
+
+func (this *kcpListener) Accept() (net.Conn, error) {
+	conn, err := this.Listener.AcceptKCP()
+	if err != nil {
+		return nil, err
+	}
+	opts := this.options
+	conn.SetStreamMode(true) //cosnet 按字节流解析消息
+	conn.SetWriteDelay(false)
+	conn.SetNoDelay(opts.NoDelay, opts.Interval, opts.Resend, opts.NC)
+	conn.SetWindowSize(opts.SndWnd, opts.RcvWnd)
+	conn.SetACKNoDelay(opts.AckNoDelay)
+	if opts.MTU > 0 {
+		conn.SetMtu(opts.MTU)
+	}
+	return conn, nil
+}
+
+// IsKCP 是否 KCP 连接
+func IsKCP(sock *cosnet.Socket) bool {
+	_, ok := sock.RemoteAddr().(*net.UDPAddr)
+	return ok
+}
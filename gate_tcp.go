@@ -2,15 +2,15 @@ package gateway
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/hwcer/cosgo/binder"
 	"github.com/hwcer/cosnet/message"
-	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/gateway/errors"
 	"github.com/hwcer/gateway/gwcfg"
 	"github.com/hwcer/gateway/players"
 	"github.com/hwcer/gateway/token"
@@ -46,24 +46,28 @@ func (this *TcpServer) init() error {
 	session.On(session.EventHeartbeat, this.heartbeat)
 
 	// 注册事件回调
+	this.Sockets.On(cosnet.EventTypeConnected, this.Connected)
 	this.Sockets.On(cosnet.EventTypeReplaced, this.S2CReplaced)
 	this.Sockets.On(cosnet.EventTypeDisconnect, this.Disconnect)
 	this.Sockets.On(cosnet.EventTypeAuthentication, this.S2CSecret)
 	this.Sockets.Options.Heartbeat = 0 //关闭计时器,由session接管
 	// 注册服务
 	service := this.Sockets.Service()
-	for k := range cosrpc.Service {
-		_ = service.Register(this.proxy, fmt.Sprintf("/%s/*", k))
+	for _, k := range Setting.Services() {
+		_ = service.Register(this.throttle(this.proxy), fmt.Sprintf("/%s/*", k))
 	}
 
 	if Setting.C2SOAuth != "" {
-		_ = service.Register(this.C2SOAuth, Setting.C2SOAuth) // 注册认证服务
+		_ = service.Register(this.throttle(this.C2SOAuth), Setting.C2SOAuth) // 注册认证服务
 	}
 	if Setting.C2SHeartbeat != "" {
-		_ = service.Register(this.C2SHeartbeat, Setting.C2SHeartbeat)
+		_ = service.Register(this.throttle(this.C2SHeartbeat), Setting.C2SHeartbeat)
 	}
 	if Setting.C2SReconnect != "" {
-		_ = service.Register(this.C2SReconnect, Setting.C2SReconnect)
+		_ = service.Register(this.throttle(this.C2SReconnect), Setting.C2SReconnect)
+	}
+	if Setting.C2SAck != "" {
+		_ = service.Register(this.throttle(this.C2SAck), Setting.C2SAck)
 	}
 
 	// 设置序列化器
@@ -93,11 +97,13 @@ func (this *TcpServer) serialize(c *cosnet.Context, reply any) ([]byte, error) {
 // 返回值:
 //   - error: 监听过程中的错误
 func (this *TcpServer) Listen(address string) error {
-	_, err := this.Sockets.Listen(address)
-	if err == nil {
-		logger.Trace("网关长连接启动：%v", gwcfg.Options.Gate.Address)
+	ln, err := this.Sockets.Listen(address)
+	if err != nil {
+		return err
 	}
-	return err
+	Drain.listen(ln)
+	logger.Trace("网关长连接启动：%v", gwcfg.Options.Gate.Address)
+	return nil
 }
 
 func (this *TcpServer) heartbeat(i any) {
@@ -115,6 +121,7 @@ func (this *TcpServer) heartbeat(i any) {
 // 返回值:
 //   - error: 接受连接过程中的错误
 func (this *TcpServer) Accept(ln net.Listener) error {
+	Drain.listen(ln)
 	this.Sockets.Accept(&tcp.Listener{Listener: ln})
 	logger.Trace("网关长连接启动：%v", gwcfg.Options.Gate.Address)
 	return nil
@@ -128,9 +135,22 @@ func (this *TcpServer) Accept(ln net.Listener) error {
 //   - any: 当前时间戳（毫秒）
 func (this *TcpServer) C2SHeartbeat(c *cosnet.Context) any {
 	ms := time.Now().UnixMilli()
+	if Stream.Enable() {
+		this.C2SAck(c)
+	}
 	return ms
 }
 
+// C2SAck 可靠推送确认,body 为最后收到的序号
+func (this *TcpServer) C2SAck(c *cosnet.Context) any {
+	if p := c.Socket.Data(); p != nil {
+		if ack, ok := parseAck(c.Message.Body()); ok {
+			Stream.Ack(p, ack)
+		}
+	}
+	return nil
+}
+
 // C2SOAuth 处理认证请求
 // 参数:
 //   - c: cosnet上下文
@@ -143,21 +163,19 @@ func (this *TcpServer) C2SOAuth(c *cosnet.Context) any {
 		return err
 	}
 	// 验证 token
-	data, err := token.Verify(args)
+	ctx := SocketContext{Context: c}
+	data, err := token.VerifyWithIP(args, ctx.RemoteAddr())
 	if err != nil {
 		return err
 	}
 	// 创建 socket 代理并登录
-	ctx := SocketContext{Context: c}
-	vs := values.Values{}
-	if data.Developer {
-		vs.Set(gwcfg.ServiceMetadataDeveloper, "1")
-	} else {
-		vs.Set(gwcfg.ServiceMetadataDeveloper, "")
-	}
+	vs := Access.Values(data)
 	if _, err = ctx.Login(data.Openid, vs); err != nil {
 		return err
 	}
+	if p := c.Socket.Data(); p != nil {
+		Stream.Login(p, c.Socket, token.ArgsReliableOf(args))
+	}
 
 	if Setting.G2SOAuth == "" {
 		return nil
@@ -238,23 +256,104 @@ func (this *TcpServer) S2CReplaced(sock *cosnet.Socket, i any) {
 //   - c: cosnet上下文
 //
 // 返回值:
-//   - any: 重连结果
+//   - any: 重连结果,body 为 ReconnectArgs JSON 并且开启可靠推送时返回 ReconnectReply
 func (this *TcpServer) C2SReconnect(c *cosnet.Context) any {
-	secret := string(c.Message.Body())
-	if secret == "" {
+	body := c.Message.Body()
+	var args *ReconnectArgs
+	if len(body) > 0 && body[0] == '{' {
+		args = &ReconnectArgs{}
+		if err := json.Unmarshal(body, args); err != nil {
+			return err
+		}
+	} else {
+		args = &ReconnectArgs{Secret: string(body), Ack: -1}
+	}
+	if args.Secret == "" {
 		return values.Error("secret empty")
 	}
-	if _, err := players.Reconnect(c.Socket, secret); err != nil {
+	p, err := players.Reconnect(c.Socket, args.Secret)
+	if err != nil {
 		return err
 	}
+	if p == nil {
+		return true
+	}
+	if Stream.Enable() && args.Ack >= 0 {
+		return Stream.Replay(p, c.Socket, args.Ack)
+	}
+	Stream.Close(p)
+	Pending.Flush(p, c.Socket)
 	return true
 }
 
+// Connected 新连接,正在关闭,IP不允许访问或超出连接数限制时断开
+// 所有监听方式(Listen,Accept,KCP)建立的连接都在这里检查
+func (this *TcpServer) Connected(sock *cosnet.Socket, _ any) {
+	if Drain.Draining() {
+		this.Kick(sock, Drain.Error())
+		return
+	}
+	if ip := SocketIP(sock); !gwcfg.IPFilter.Allow(ip) {
+		logger.Debug("IP禁止访问,IP:%s", ip)
+		this.Kick(sock, errors.ErrAddressDenied)
+		return
+	}
+	if err := Conns.Connect(sock); err != nil {
+		this.Kick(sock, err)
+	}
+}
+
+// throttle 检查单个连接的消息频率,超出时断开
+func (this *TcpServer) throttle(f func(c *cosnet.Context) any) func(c *cosnet.Context) any {
+	return func(c *cosnet.Context) any {
+		if !c.Socket.IsReady() {
+			return nil //已被拒绝或正在关闭的连接,不在 Conns 中计数,直接丢弃
+		}
+		if err := Conns.Message(c.Socket); err != nil {
+			this.Kick(c.Socket, err)
+			return nil
+		}
+		return f(c)
+	}
+}
+
+// S2CDisconnect 网关主动断开连接前发送原因,推送积压时也会调用,不能阻塞
+// 参数:
+//   - sock: cosnet socket
+//   - reason: 断开原因,一般为 errors 中的错误码
+func (this *TcpServer) S2CDisconnect(sock *cosnet.Socket, reason error) {
+	if Setting.S2CDisconnect == nil {
+		return //不需要通知
+	}
+	if S2CDisconnectHandle, ok := Setting.S2CDisconnect.(S2CDisconnect); ok {
+		S2CDisconnectHandle.S2CDisconnect(sock, reason)
+	} else if S2CDisconnectString, ok := Setting.S2CDisconnect.(string); ok {
+		_ = sock.SendWithMagic(message.MagicNumberPathJson, message.FlagNoreply, 0, S2CDisconnectString, values.Error(reason), false) //不阻塞,发送缓冲已满时放弃通知
+	} else {
+		logger.Alert("gateway Setting.S2CDisconnect not support")
+	}
+}
+
+// Kick 发送 S2CDisconnect 后断开连接
+func (this *TcpServer) Kick(sock *cosnet.Socket, reason error) {
+	this.S2CDisconnect(sock, reason)
+	sock.Close()
+}
+
 // Disconnect 处理断开连接事件
 // 参数:
 //   - sock: cosnet socket
 //   - _: 事件数据（未使用）
 func (this *TcpServer) Disconnect(sock *cosnet.Socket, _ any) {
+	wsSockets.Delete(sock.Id())
+	Conns.Disconnect(sock)
+	if ms := Outbound.Remove(sock); len(ms) > 0 {
+		if p := sock.Data(); p != nil && !Stream.Reliable(p) {
+			for _, m := range ms {
+				Pending.Push(p, m) //积压中带 _msg_buffer 的推送,重连后补发
+			}
+		}
+	}
 	if err := players.Disconnect(sock); err != nil {
 		logger.Alert("Disconnect error:%v", err)
 	}
@@ -333,6 +432,17 @@ func (this *SocketContext) Session() *session.Data {
 	return this.Context.Socket.Data()
 }
 
+// Protocol 请求使用的协议,区分 TCP,websocket 和 KCP
+func (this *SocketContext) Protocol() int8 {
+	if IsWebSocket(this.Context.Socket) {
+		return gwcfg.ProtocolTypeWSS
+	}
+	if IsKCP(this.Context.Socket) {
+		return gwcfg.ProtocolTypeKCP
+	}
+	return gwcfg.ProtocolTypeTCP
+}
+
 // Socket 获取socket
 // 返回值:
 //   - *cosnet.Socket: cosnet socket
@@ -385,9 +495,5 @@ func (this *SocketContext) Metadata() values.Metadata {
 // 返回值:
 //   - string: 远程地址
 func (this *SocketContext) RemoteAddr() string {
-	ip := this.Context.RemoteAddr().String()
-	if i := strings.Index(ip, ":"); i > 0 {
-		ip = ip[0:i]
-	}
-	return ip
+	return gwcfg.RemoteIP(this.Context.RemoteAddr().String())
 }
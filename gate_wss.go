@@ -3,6 +3,7 @@ package gateway
 import (
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosnet"
@@ -10,6 +11,7 @@ import (
 	"github.com/hwcer/gateway/errors"
 	"github.com/hwcer/gateway/gwcfg"
 	"github.com/hwcer/gateway/players"
+	"github.com/hwcer/gateway/token"
 	"github.com/hwcer/logger"
 )
 
@@ -22,35 +24,71 @@ const (
 	WS_Auth_Sec_WebSocket_Protocol = "auth"
 )
 
+// wsSockets 通过 websocket 建立的连接
+var wsSockets = sync.Map{}
+
+// IsWebSocket 是否 websocket 连接
+func IsWebSocket(sock *cosnet.Socket) bool {
+	_, ok := wsSockets.Load(sock.Id())
+	return ok
+}
+
 func WSVerify(_ http.ResponseWriter, r *http.Request) (meta map[string]string, err error) {
-	qs := r.URL.Query()
-	if gwcfg.Options.Maintenance {
-		secret := qs.Get("secret")
-		if secret == "" || secret != gwcfg.Options.Developer {
-			return nil, errors.ErrServerMaintenance
-		}
+	if Drain.Draining() {
+		return nil, Drain.Error()
+	}
+	ip := wsRemoteAddr(r)
+	if !gwcfg.IPFilter.Allow(ip) {
+		return nil, errors.ErrAddressDenied
+	}
+	if !Conns.Allow(ip) {
+		return nil, errors.ErrTooManyConnections
 	}
+	qs := r.URL.Query()
 	// 优先从次级协议获取 token（格式: "auth, <token>"），其次从 query 获取
-	var token string
+	var ts string
 	if proto := r.Header.Get("Sec-WebSocket-Protocol"); proto != "" {
 		if parts := strings.SplitN(proto, ",", 2); len(parts) == 2 && strings.TrimSpace(parts[0]) == WS_Auth_Sec_WebSocket_Protocol {
-			token = strings.TrimSpace(parts[1])
+			ts = strings.TrimSpace(parts[1])
 		}
 	}
-	if token == "" {
-		token = qs.Get(session.Options.Name)
+	if ts == "" {
+		ts = qs.Get(session.Options.Name)
 	}
-	if token == "" {
-		return nil, nil
+	var ss *session.Session
+	if ts != "" {
+		ss = session.New()
+		meta = map[string]string{gwcfg.ServiceMetadataGUID: ss.Data.UUID()}
+		if err = ss.Verify(ts); err == nil && !players.Blocked(ss.Data.UUID()) {
+			meta[gwcfg.ServiceMetadataGUID] = ss.Data.UUID()
+		} else {
+			ss = nil
+		}
 	}
-	ss := session.New()
-	meta = map[string]string{gwcfg.ServiceMetadataGUID: ss.Data.UUID()}
-	if err = ss.Verify(token); err == nil {
-		meta[gwcfg.ServiceMetadataGUID] = ss.Data.UUID()
+	// 维护模式: 已登录的开发者,白名单,GM秘钥允许进入
+	if gwcfg.Maintain.Active() {
+		var guid string
+		if ss != nil {
+			guid = ss.Data.UUID()
+		}
+		if !(ss != nil && Access.IsDeveloper(ss.Data)) && !gwcfg.Maintain.Allow(guid, ip) {
+			if secret := qs.Get("secret"); secret == "" {
+				return nil, gwcfg.Maintain.Error()
+			} else if _, e := token.DeveloperVerify(secret, ip); e != nil {
+				return nil, gwcfg.Maintain.Error()
+			}
+		}
 	}
 	return meta, nil
 }
+
+// wsRemoteAddr 握手请求的客户端IP
+func wsRemoteAddr(r *http.Request) string {
+	return gwcfg.RemoteIP(r.RemoteAddr)
+}
+
 func WSAccept(sock *cosnet.Socket, meta map[string]string) {
+	wsSockets.Store(sock.Id(), struct{}{})
 	if len(meta) == 0 {
 		return
 	}
@@ -59,8 +97,12 @@ func WSAccept(sock *cosnet.Socket, meta map[string]string) {
 		return
 	}
 	value := gwcfg.Cookies.Filter(meta)
-	if _, err := players.Connect(sock, uuid, value); err != nil {
+	if p, err := players.Connect(sock, uuid, value); err != nil {
 		logger.Alert("wss session create fail:%v", err)
+	} else if Stream.Reliable(p) {
+		Stream.Login(p, sock, true) //使用 token 连接时补发所有未确认的推送,客户端按序号去重
+	} else {
+		Pending.Flush(p, sock)
 	}
 
 }
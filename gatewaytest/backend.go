@@ -0,0 +1,146 @@
+package gatewaytest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hwcer/cosgo/binder"
+	"github.com/hwcer/cosgo/registry"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+// Handler 模拟游戏服接口
+type Handler func(r *Request) (reply any, err error)
+
+// Request 网关转发到后端的请求
+type Request struct {
+	Path     string          //servicePath
+	Method   string          //serviceMethod,已经去掉 gwcfg.Options.Gate.Prefix
+	Body     []byte          //请求体
+	Metadata values.Metadata //网关传入的元数据
+	Header   values.Metadata //返回给网关的元数据
+}
+
+// Bind 使用 JSON 解析请求体
+func (r *Request) Bind(i any) error {
+	if len(r.Body) == 0 {
+		return nil
+	}
+	return binder.Json.Unmarshal(r.Body, i)
+}
+
+// GUID 当前登录的账号
+func (r *Request) GUID() string {
+	return r.Metadata.Get(gwcfg.ServiceMetadataGUID)
+}
+
+// UID 当前选择的角色
+func (r *Request) UID() string {
+	return r.Metadata.Get(gwcfg.ServiceMetadataUID)
+}
+
+// Login 通知网关激活登录信息,cookies 必须在 gwcfg.Cookies 中启用
+func (r *Request) Login(guid string, cookies ...values.Metadata) {
+	r.Header[gwcfg.ServicePlayerLogin] = guid
+	for _, c := range cookies {
+		for k, v := range c {
+			r.Header[k] = v
+		}
+	}
+}
+
+// Logout 通知网关退出登录
+func (r *Request) Logout() {
+	r.Header[gwcfg.ServicePlayerLogout] = "1"
+}
+
+// Set 更新 session cookie,加入或者离开频道等
+func (r *Request) Set(k, v string) {
+	r.Header[k] = v
+}
+
+// NewBackend 创建进程内的后端服务
+func NewBackend() *Backend {
+	return &Backend{dict: map[string]Handler{}}
+}
+
+// Backend 进程内的 cosrpc 后端,替换 gateway.Setting.Caller
+type Backend struct {
+	dict     map[string]Handler
+	services []string
+	locker   sync.RWMutex
+}
+
+func (b *Backend) name(servicePath, serviceMethod string) string {
+	return strings.ToLower(registry.Join(servicePath, serviceMethod))
+}
+
+// Register 注册接口,serviceMethod 不需要包含 gwcfg.Options.Gate.Prefix
+// 服务必须在 Start 之前注册,网关启动时按服务名注册代理路由
+func (b *Backend) Register(servicePath, serviceMethod string, h Handler) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	servicePath = registry.Formatter(servicePath)
+	exist := false
+	for _, s := range b.services {
+		if s == servicePath {
+			exist = true
+		}
+	}
+	if !exist {
+		b.services = append(b.services, servicePath)
+	}
+	b.dict[b.name(servicePath, registry.Formatter(serviceMethod))] = h
+}
+
+// Services 实现 gateway.Setting.Services
+func (b *Backend) Services() []string {
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	return append([]string{}, b.services...)
+}
+
+// Call 实现 gateway.Setting.Caller
+func (b *Backend) Call(req, res values.Metadata, servicePath, serviceMethod string, args, reply any) (err error) {
+	if gwcfg.Options.Gate.Prefix != "" {
+		serviceMethod = gwcfg.TrimServiceMethod(serviceMethod)
+	}
+	b.locker.RLock()
+	h := b.dict[b.name(servicePath, serviceMethod)]
+	b.locker.RUnlock()
+	if h == nil {
+		return errors.ErrNotFount
+	}
+	r := &Request{Path: servicePath, Method: serviceMethod, Metadata: req, Header: res}
+	if r.Header == nil {
+		r.Header = values.Metadata{}
+	}
+	switch v := args.(type) {
+	case []byte:
+		r.Body = v
+	case nil:
+	default:
+		if r.Body, err = binder.Json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	var v any
+	if v, err = h(r); err != nil {
+		return err
+	}
+	p, ok := reply.(*[]byte)
+	if !ok {
+		return fmt.Errorf("gatewaytest: reply type not support:%T", reply)
+	}
+	switch d := v.(type) {
+	case nil:
+	case []byte:
+		*p = d
+	default:
+		*p, err = binder.Json.Marshal(d)
+	}
+	return err
+}
@@ -0,0 +1,602 @@
+package gatewaytest_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gatewaytest"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/token"
+)
+
+// 所有测试共用同一个网关
+var srv *gatewaytest.Server
+
+const developer = "gatewaytest-developer"
+
+func TestMain(m *testing.M) {
+	backend := gatewaytest.NewBackend()
+	backend.Register("game", "echo", func(r *gatewaytest.Request) (any, error) {
+		return r.Body, nil
+	})
+	backend.Register("game", "whoami", func(r *gatewaytest.Request) (any, error) {
+		return r.GUID(), nil
+	})
+	backend.Register("game", "server", func(r *gatewaytest.Request) (any, error) {
+		var sid string
+		if err := r.Bind(&sid); err != nil {
+			return nil, err
+		}
+		r.Set(gwcfg.ServiceMetadataServerId, sid)
+		return true, nil
+	})
+	backend.Register("game", "limited", func(r *gatewaytest.Request) (any, error) {
+		return true, nil
+	})
+	gateway.Setting.Admin = "_admin"
+	gateway.Setting.S2CDisconnect = "S2CDisconnect"
+	gateway.Setting.S2CMaintenance = "S2CMaintenance"
+	gateway.Setting.Poll = "poll"
+	var err error
+	if srv, err = gatewaytest.Start(backend, &gatewaytest.Options{Developer: developer}); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	_ = srv.Close()
+	os.Exit(code)
+}
+
+// login 使用平台凭证登录长连接
+func login(t *testing.T, guid string) *gatewaytest.SocketClient {
+	t.Helper()
+	access, err := srv.Access(guid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if _, err = c.OAuth(&token.ArgsDefault{Access: access}); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetSecret() == "" {
+		t.Fatal("S2CSecret not received")
+	}
+	return c
+}
+
+// push 模拟游戏服调用 send
+func push(t *testing.T, guid, path string, body string, mate ...values.Metadata) {
+	t.Helper()
+	m := values.Metadata{gwcfg.ServiceMetadataGUID: guid, gwcfg.ServiceMessagePath: path}
+	for _, v := range mate {
+		for k, s := range v {
+			m[k] = s
+		}
+	}
+	if err := srv.Send(m, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasCode 返回结果是否为指定错误码
+func hasCode(body []byte, err *values.Message) bool {
+	return bytes.Contains(body, []byte(fmt.Sprintf(`"code":%d`, err.Code)))
+}
+
+func TestHttpOAuth(t *testing.T) {
+	access, err := srv.Access("http-user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := srv.NewHttpClient()
+	res, err := c.OAuth(&token.ArgsDefault{Access: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != 200 || c.Token == "" {
+		t.Fatalf("oauth status:%d token:%q body:%s", res.Status, c.Token, res.Body)
+	}
+	if res, err = c.Request("/game/whoami", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(res.Body, []byte("http-user")) {
+		t.Fatalf("whoami body:%s", res.Body)
+	}
+}
+
+func TestHttpOAuthInvalid(t *testing.T) {
+	c := srv.NewHttpClient()
+	res, err := c.OAuth(&token.ArgsDefault{Access: "invalid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "" {
+		t.Fatalf("invalid access logged in, body:%s", res.Body)
+	}
+}
+
+func TestTCPSend(t *testing.T) {
+	c := login(t, "tcp-send")
+	if _, err := c.Heartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.Request("/game/echo", []byte(`"hello"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(msg.Body, []byte("hello")) {
+		t.Fatalf("echo body:%s", msg.Body)
+	}
+	push(t, "tcp-send", "notice", `"hi"`)
+	if msg, err = c.Wait("notice"); err != nil {
+		t.Fatal(err)
+	}
+	if msg.String() != "hi" {
+		t.Fatalf("notice body:%s", msg.Body)
+	}
+}
+
+func TestTCPReconnect(t *testing.T) {
+	c := login(t, "tcp-reconnect")
+	secret := c.GetSecret()
+	c.Close()
+
+	r, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err = r.Reconnect(secret); err != nil {
+		t.Fatal(err)
+	}
+	push(t, "tcp-reconnect", "notice", `"back"`)
+	if _, err = r.Wait("notice"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWSSToken(t *testing.T) {
+	access, err := srv.Access("wss-user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := srv.NewHttpClient()
+	if _, err = h.OAuth(&token.ArgsDefault{Access: access}); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := srv.DialWSS(h.Token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	push(t, "wss-user", "notice", `"wss"`)
+	if _, err = c.Wait("notice"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	if err := gwcfg.Limits.Load([]*gwcfg.Limit{{Route: "/game/limited", Key: gwcfg.LimitKeyGUID, Rate: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = gwcfg.Limits.Load(nil) })
+	c := login(t, "rate-limit")
+	msg, err := c.Request("/game/limited", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasCode(msg.Body, errors.ErrTooManyRequests) {
+		t.Fatalf("first request limited:%s", msg.Body)
+	}
+	if msg, err = c.Request("/game/limited", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !hasCode(msg.Body, errors.ErrTooManyRequests) {
+		t.Fatalf("second request not limited:%s", msg.Body)
+	}
+	// 其他接口不受影响,其他账号分别计数
+	if msg, err = c.Request("/game/echo", []byte(`"ok"`)); err != nil || hasCode(msg.Body, errors.ErrTooManyRequests) {
+		t.Fatalf("echo limited err:%v", err)
+	}
+	other := login(t, "rate-limit-other")
+	if msg, err = other.Request("/game/limited", nil); err != nil || hasCode(msg.Body, errors.ErrTooManyRequests) {
+		t.Fatalf("other guid limited err:%v", err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	if err := gwcfg.IPFilter.Load(&gwcfg.ACL{Deny: []string{"127.0.0.0/8", "::1"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = gwcfg.IPFilter.Load(nil) })
+	c, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	msg, err := c.Wait("S2CDisconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasCode(msg.Body, errors.ErrAddressDenied) {
+		t.Fatalf("S2CDisconnect body:%s", msg.Body)
+	}
+	res, err := srv.NewHttpClient().Request("/game/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != 403 {
+		t.Fatalf("http status:%d", res.Status)
+	}
+}
+
+// admin 使用开发者秘钥调用管理接口,返回 HTTP 状态和结果
+func admin(t *testing.T, secret, action, body string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL("/_admin/"+action), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+secret)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, b
+}
+
+func TestAdminPermission(t *testing.T) {
+	developers, roles := gwcfg.Options.Developers, gwcfg.Options.Roles
+	t.Cleanup(func() { gwcfg.Options.Developers, gwcfg.Options.Roles = developers, roles })
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	gwcfg.Options.Roles = map[string][]string{"all": {gwcfg.PermissionAll}, "ops": {gateway.AdminPermissionRead, gateway.AdminPermissionWrite}}
+	gwcfg.Options.Developers = []*gwcfg.Developer{
+		{Name: "norole", Secret: hash("norole-secret")},
+		{Name: "all", Secret: hash("all-secret"), Role: "all"},
+		{Name: "ops", Secret: hash("ops-secret"), Role: "ops"},
+	}
+	cases := []struct {
+		secret string
+		action string
+		body   string
+		denied bool
+	}{
+		{developer, "players", "", true}, //共用秘钥没有角色
+		{"norole-secret", "players", "", true},
+		{"all-secret", "players", "", false},
+		{"all-secret", "kick", `{"guid":"admin-nobody"}`, true}, //* 不授予写权限
+		{"ops-secret", "players", "", false},
+		{"ops-secret", "kick", `{"guid":"admin-nobody"}`, false},
+	}
+	for _, c := range cases {
+		_, body := admin(t, c.secret, c.action, c.body)
+		if denied := hasCode(body, errors.ErrPermissionDenied); denied != c.denied {
+			t.Errorf("%s %s denied:%v body:%s", c.secret, c.action, denied, body)
+		}
+	}
+}
+
+func TestKickReconnect(t *testing.T) {
+	c := login(t, "kick-user")
+	secret := c.GetSecret()
+	if _, err := gateway.KickPlayer(values.Metadata{gwcfg.ServiceMetadataGUID: "kick-user"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Wait("S2CDisconnect"); err != nil {
+		t.Fatal(err)
+	}
+	// 旧秘钥不能断线重连
+	r, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err = r.Reconnect(secret); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := r.Request("/game/whoami", nil); err != nil || bytes.Contains(msg.Body, []byte("kick-user")) {
+		t.Fatalf("old secret reconnected err:%v", err)
+	}
+	// 重新登录后新秘钥可以断线重连
+	n := login(t, "kick-user")
+	secret = n.GetSecret()
+	n.Close()
+	a, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	msg, err := a.Reconnect(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasCode(msg.Body, errors.ErrKicked) {
+		t.Fatalf("new secret reconnect blocked:%s", msg.Body)
+	}
+	push(t, "kick-user", "notice", `"back"`)
+	if _, err = a.Wait("notice"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	t.Cleanup(func() { _, _ = gateway.SetMaintenance(values.Metadata{gateway.MaintenanceReset: "1"}, nil) })
+	tester := login(t, "maint-tester")
+	player := login(t, "maint-player")
+	// 计划开始前推送公告
+	now := time.Now().Unix()
+	body := fmt.Sprintf(`{"start":%d,"notice":"update","guid":["maint-tester"],"notify":600,"kick":true}`, now+60)
+	if _, err := gateway.SetMaintenance(nil, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*gatewaytest.SocketClient{tester, player} {
+		msg, err := c.Wait("S2CMaintenance")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(msg.Body, []byte(`"notice":"update"`)) {
+			t.Fatalf("S2CMaintenance body:%s", msg.Body)
+		}
+	}
+	// 开始时断开白名单以外的玩家
+	body = fmt.Sprintf(`{"start":%d,"notice":"update","guid":["maint-tester"],"kick":true}`, now-1)
+	r, err := gateway.SetMaintenance(nil, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Active || !r.Runtime {
+		t.Fatalf("maintenance status:%+v", r)
+	}
+	msg, err := player.Wait("S2CDisconnect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasCode(msg.Body, errors.ErrServerMaintenance) {
+		t.Fatalf("S2CDisconnect body:%s", msg.Body)
+	}
+	if msg, err = tester.Request("/game/whoami", nil); err != nil || !bytes.Contains(msg.Body, []byte("maint-tester")) {
+		t.Fatalf("whitelist request err:%v", err)
+	}
+	// 维护期间白名单以外不能登录
+	access, err := srv.Access("maint-player", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if msg, err = c.OAuth(&token.ArgsDefault{Access: access}); err != nil || !hasCode(msg.Body, errors.ErrServerMaintenance) {
+		t.Fatalf("login during maintenance err:%v", err)
+	}
+	// 恢复使用配置文件后可以登录
+	if r, err = gateway.SetMaintenance(values.Metadata{gateway.MaintenanceReset: "1"}, nil); err != nil || r.Active {
+		t.Fatalf("reset status:%+v err:%v", r, err)
+	}
+	login(t, "maint-player")
+}
+
+func TestMulticast(t *testing.T) {
+	a, b := login(t, "multicast-a"), login(t, "multicast-b")
+	mate := values.Metadata{gwcfg.ServiceMessagePath: "notice", gwcfg.ServiceMessageGUID: "multicast-a,multicast-b,multicast-a,multicast-none"}
+	r, err := gateway.Multicast(mate, []byte(`"all"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Delivered != 2 || r.Offline != 1 {
+		t.Fatalf("result:%+v", r)
+	}
+	for _, c := range []*gatewaytest.SocketClient{a, b} {
+		msg, err := c.Wait("notice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.String() != "all" {
+			t.Fatalf("notice body:%s", msg.Body)
+		}
+	}
+}
+
+func TestBroadcastFilter(t *testing.T) {
+	a, b := login(t, "filter-a"), login(t, "filter-b")
+	for c, sid := range map[*gatewaytest.SocketClient]string{a: "1001", b: "1002"} {
+		if _, err := c.Request("/game/server", sid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mate := values.Metadata{
+		gwcfg.ServiceMessagePath:                                   "filter",
+		gwcfg.ServiceMessageWait:                                   "1",
+		gwcfg.ServiceMessageFilter + gwcfg.ServiceMetadataServerId: "1001",
+	}
+	if err := srv.Broadcast(mate, []byte(`"s1"`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Wait("filter"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Wait("filter", 200*time.Millisecond); err != gatewaytest.ErrTimeout {
+		t.Fatalf("filtered player received broadcast:%v", err)
+	}
+}
+
+func TestBroadcastOrder(t *testing.T) {
+	c := login(t, "broadcast-order")
+	for i := 0; i < 20; i++ {
+		if err := srv.Broadcast(values.Metadata{gwcfg.ServiceMessagePath: "order"}, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		msg, err := c.Wait("order")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.String() != strconv.Itoa(i) {
+			t.Fatalf("broadcast %d received:%s", i, msg.Body)
+		}
+	}
+}
+
+func TestPendingBuffer(t *testing.T) {
+	c := login(t, "pending-user")
+	secret := c.GetSecret()
+	c.Close()
+	time.Sleep(100 * time.Millisecond) //等待网关处理断开
+	push(t, "pending-user", "buffered", `"keep"`, values.Metadata{gwcfg.ServiceMessageBuffer: "1"})
+	push(t, "pending-user", "dropped", `"drop"`)
+	r, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err = r.Reconnect(secret); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := r.Wait("buffered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.String() != "keep" {
+		t.Fatalf("buffered body:%s", msg.Body)
+	}
+	if _, err = r.Wait("dropped", 200*time.Millisecond); err != gatewaytest.ErrTimeout {
+		t.Fatalf("message without _msg_buffer should be dropped:%v", err)
+	}
+}
+
+func TestReliableReplay(t *testing.T) {
+	opts := gwcfg.Options.Reliable
+	gwcfg.Options.Reliable = &gwcfg.Reliable{Enable: true}
+	t.Cleanup(func() { gwcfg.Options.Reliable = opts })
+	// 没有声明使用可靠推送的客户端不分配序号
+	u := login(t, "unreliable-user")
+	push(t, "unreliable-user", "notice", `"plain"`)
+	if msg, err := u.Wait("notice"); err != nil || msg.Index != 0 {
+		t.Fatalf("unreliable push err:%v index:%v", err, msg)
+	}
+
+	access, err := srv.Access("reliable-user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.OAuth(&token.ArgsDefault{Access: access, Reliable: true}); err != nil {
+		t.Fatal(err)
+	}
+	secret := c.GetSecret()
+	push(t, "reliable-user", "r1", `"1"`)
+	push(t, "reliable-user", "r2", `"2"`)
+	for i, path := range []string{"r1", "r2"} {
+		msg, err := c.Wait(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Index != -int32(i+1) {
+			t.Fatalf("%s index:%d", path, msg.Index)
+		}
+	}
+	c.Close()
+	time.Sleep(100 * time.Millisecond) //等待网关处理断开
+	push(t, "reliable-user", "r3", `"3"`)
+
+	r, err := srv.DialTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	msg, err := r.Request(gateway.Setting.C2SReconnect, &gateway.ReconnectArgs{Secret: secret, Ack: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret struct {
+		Data gateway.ReconnectReply `json:"data"`
+	}
+	if err = msg.Bind(&ret); err != nil {
+		t.Fatalf("reconnect reply:%s", msg.Body)
+	}
+	if reply := ret.Data; reply.Seq != 3 || reply.Replay != 2 || reply.Resync {
+		t.Fatalf("reconnect reply:%s", msg.Body)
+	}
+	for i, path := range []string{"r2", "r3"} {
+		msg, err := r.Wait(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Index != -int32(i+2) {
+			t.Fatalf("%s index:%d", path, msg.Index)
+		}
+	}
+	// 重连之后的推送继续分配序号
+	push(t, "reliable-user", "r4", `"4"`)
+	if msg, err = r.Wait("r4"); err != nil || msg.Index != -4 {
+		t.Fatalf("r4 err:%v msg:%v", err, msg)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	opts := gwcfg.Options.Poll
+	gwcfg.Options.Poll = &gwcfg.Poll{Wait: 5, Idle: 60}
+	t.Cleanup(func() { gwcfg.Options.Poll = opts })
+	access, err := srv.Access("poll-user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := srv.NewHttpClient()
+	if _, err = h.OAuth(&token.ArgsDefault{Access: access}); err != nil {
+		t.Fatal(err)
+	}
+	// 第一次轮询创建推送缓存
+	if _, err = h.Request(gateway.Setting.Poll+"?wait=0", nil); err != nil {
+		t.Fatal(err)
+	}
+	push(t, "poll-user", "json", `{"a":1}`)
+	push(t, "poll-user", "text", "plain")
+	res, err := h.Request(gateway.Setting.Poll+"?wait=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret struct {
+		Data []*gateway.PollMessage `json:"data"`
+	}
+	if err = res.Bind(&ret); err != nil || len(ret.Data) != 2 {
+		t.Fatalf("poll err:%v body:%s", err, res.Body)
+	}
+	if m := ret.Data[0]; m.Path != "json" || m.Base64 {
+		t.Fatalf("json message:%s", res.Body)
+	}
+	if m := ret.Data[1]; m.Path != "text" || !m.Base64 || m.Body != base64.StdEncoding.EncodeToString([]byte("plain")) {
+		t.Fatalf("text message:%s", res.Body)
+	}
+}
@@ -0,0 +1,89 @@
+package gatewaytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+
+	"github.com/hwcer/cosgo/binder"
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/gateway"
+)
+
+// Response HTTP 返回结果
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Bind 使用 JSON 解析返回结果
+func (r *Response) Bind(i any) error {
+	return json.Unmarshal(r.Body, i)
+}
+
+// NewHttpClient 创建短连接客户端,自动保存登录 cookie
+func (s *Server) NewHttpClient() *HttpClient {
+	jar, _ := cookiejar.New(nil)
+	c := &HttpClient{server: s}
+	c.Client = &http.Client{Jar: jar, Timeout: 10 * time.Second}
+	return c
+}
+
+// HttpClient 短连接客户端
+type HttpClient struct {
+	*http.Client
+	Token  string //登录成功后的 session token
+	server *Server
+}
+
+// Request 发送 POST 请求,body 为 []byte 时直接发送,否则使用 JSON 序列化
+func (c *HttpClient) Request(path string, body any) (r *Response, err error) {
+	var b []byte
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		b = v
+	default:
+		if b, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, c.server.URL(path), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(binder.HeaderContentType, binder.Json.Name())
+	req.Header.Set(binder.HeaderAccept, binder.Json.Name())
+	if c.Token != "" {
+		req.Header.Set(session.Options.Name, c.Token)
+	}
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	r = &Response{Status: res.StatusCode, Header: res.Header}
+	if r.Body, err = io.ReadAll(res.Body); err != nil {
+		return nil, err
+	}
+	if v := res.Header.Get("X-Forwarded-Val"); v != "" {
+		c.Token = v
+	}
+	return r, nil
+}
+
+// OAuth 使用 gateway.Setting.C2SOAuth 登录,args 一般为 token.ArgsDefault
+func (c *HttpClient) OAuth(args any) (*Response, error) {
+	return c.Request(gateway.Setting.C2SOAuth, args)
+}
+
+// Heartbeat 发送 gateway.Setting.C2SHeartbeat
+func (c *HttpClient) Heartbeat() (*Response, error) {
+	return c.Request(gateway.Setting.C2SHeartbeat, nil)
+}
@@ -0,0 +1,143 @@
+// Package gatewaytest 在进程内启动网关,用于黑盒测试
+//
+// 网关使用全局单例(gateway.TCP,gateway.HTTP,session 等),每个进程只能启动一次,
+// 一般在 TestMain 中调用 Start,所有测试共用同一个 Server
+package gatewaytest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/token"
+)
+
+var started bool
+var startedLocker sync.Mutex
+
+// Options 测试网关配置
+type Options struct {
+	Appid     string //默认 gatewaytest
+	Secret    string //平台秘钥,默认随机生成
+	Developer string //GM 秘钥,为空时不启用 GM 快速登录
+	Websocket string //websocket 路由,默认 ws
+	Prefix    string //路由强制前缀,默认 handle
+}
+
+// Server 运行中的测试网关
+type Server struct {
+	Addr    string   //监听地址 127.0.0.1:port,HTTP,TCP,WSS 共用
+	Backend *Backend //进程内的后端服务
+	Options *Options
+	module  *gateway.Module
+}
+
+// Start 在随机端口上启动网关,HTTP,TCP,WSS 全开
+// backend 中的服务必须在 Start 之前注册完毕
+func Start(backend *Backend, opts *Options) (s *Server, err error) {
+	startedLocker.Lock()
+	defer startedLocker.Unlock()
+	if started {
+		return nil, errors.New("gatewaytest: server already started")
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Appid == "" {
+		opts.Appid = "gatewaytest"
+	}
+	if opts.Secret == "" {
+		if opts.Secret, err = randomSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Websocket == "" {
+		opts.Websocket = "ws"
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "handle"
+	}
+	s = &Server{Backend: backend, Options: opts}
+	if s.Addr, err = freeAddress(); err != nil {
+		return nil, err
+	}
+	gateway.Setting.Caller = backend.Call
+	gateway.Setting.Services = backend.Services
+
+	gwcfg.Options.Appid = opts.Appid
+	gwcfg.Options.Secret = opts.Secret
+	gwcfg.Options.Developer = opts.Developer
+	gwcfg.Options.Gate.Address = s.Addr
+	gwcfg.Options.Gate.Prefix = opts.Prefix
+	gwcfg.Options.Gate.Websocket = opts.Websocket
+	gwcfg.Options.Gate.Protocol = 7 //WSS|TCP|HTTP
+
+	s.module = gateway.New()
+	if err = s.module.Init(); err != nil {
+		return nil, err
+	}
+	if err = s.module.Start(); err != nil {
+		return nil, err
+	}
+	started = true
+	return s, nil
+}
+
+// Close 关闭网关,等待平滑关闭完成
+func (s *Server) Close() error {
+	err := s.module.Close()
+	<-gateway.Drain.Shutdown()
+	return err
+}
+
+// Access 使用平台秘钥生成登录凭证,用于 C2SOAuth 参数中的 access
+func (s *Server) Access(openid string, attach values.Values) (string, error) {
+	r := token.Result{Appid: s.Options.Appid, Openid: openid, Attach: attach}
+	return token.Issue(r, s.Options.Secret)
+}
+
+// Send 模拟游戏服调用网关 send 接口
+func (s *Server) Send(mate values.Metadata, body []byte) error {
+	return gateway.Send(mate, body)
+}
+
+// Write 模拟游戏服调用网关 write 接口
+func (s *Server) Write(mate values.Metadata, body []byte) error {
+	return gateway.Write(mate, body)
+}
+
+// Broadcast 模拟游戏服调用网关 broadcast 接口
+func (s *Server) Broadcast(mate values.Metadata, body []byte) error {
+	return gateway.Broadcast(mate, body)
+}
+
+// URL 拼接 HTTP 地址
+func (s *Server) URL(path string) string {
+	return fmt.Sprintf("http://%s/%s", s.Addr, strings.TrimPrefix(path, "/"))
+}
+
+func freeAddress() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	return ln.Addr().String(), nil
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,315 @@
+package gatewaytest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/cosnet/message"
+	"github.com/hwcer/cosnet/tcp"
+	"github.com/hwcer/gateway"
+)
+
+// Timeout 等待服务器返回的默认超时时间
+var Timeout = 5 * time.Second
+
+var ErrTimeout = errors.New("gatewaytest: wait message timeout")
+
+// Message 客户端收到的消息
+type Message struct {
+	Path  string
+	Flag  message.Flag
+	Index int32
+	Body  []byte
+}
+
+// Bind 使用 JSON 解析消息体
+func (m *Message) Bind(i any) error {
+	return json.Unmarshal(m.Body, i)
+}
+
+// String 消息体字符串,S2CSecret,S2CReplaced 等 JSON 字符串会去掉引号
+func (m *Message) String() string {
+	var s string
+	if err := json.Unmarshal(m.Body, &s); err == nil {
+		return s
+	}
+	return string(m.Body)
+}
+
+// DialTCP 使用 TCP 长连接连接网关
+func (s *Server) DialTCP() (*SocketClient, error) {
+	conn, err := net.DialTimeout("tcp", s.Addr, Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newSocketClient(conn)
+}
+
+// DialWSS 使用 websocket 连接网关
+// token 不为空时通过次级协议 "auth, <token>" 传递,握手时自动登录
+// query 追加到地址中,例如维护模式下的 secret=xxx
+func (s *Server) DialWSS(token string, query string) (*SocketClient, *http.Response, error) {
+	address := fmt.Sprintf("ws://%s/%s", s.Addr, strings.TrimPrefix(s.Options.Websocket, "/"))
+	if query != "" {
+		address += "?" + query
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: Timeout}
+	if token != "" {
+		dialer.Subprotocols = []string{gateway.WS_Auth_Sec_WebSocket_Protocol, token}
+	}
+	ws, res, err := dialer.Dial(address, nil)
+	if err != nil {
+		return nil, res, err
+	}
+	c, err := newSocketClient(&wsConn{Conn: ws})
+	return c, res, err
+}
+
+// SocketClient TCP,WSS 客户端,使用 cosnet 收发消息,与真实客户端的协议格式一致
+type SocketClient struct {
+	*cosnet.Socket
+	Secret   string //S2CSecret 下发的断线重连秘钥
+	index    int32
+	sockets  *cosnet.Sockets
+	pending  map[int32]chan *Message
+	messages chan *Message
+	locker   sync.Mutex
+}
+
+func newSocketClient(conn net.Conn) (c *SocketClient, err error) {
+	c = &SocketClient{sockets: cosnet.New(), pending: map[int32]chan *Message{}, messages: make(chan *Message, 1024)}
+	c.sockets.Options.Heartbeat = 0
+	connected := make(chan *cosnet.Socket, 1)
+	c.sockets.On(cosnet.EventTypeConnected, func(sock *cosnet.Socket, _ any) {
+		connected <- sock
+	})
+	if err = c.sockets.Service().Register(c.receive, "/*"); err != nil {
+		return nil, err
+	}
+	if err = c.sockets.Start(); err != nil {
+		return nil, err
+	}
+	c.sockets.Accept(&tcp.Listener{Listener: newConnListener(conn)})
+	select {
+	case c.Socket = <-connected:
+	case <-time.After(Timeout):
+		_ = conn.Close()
+		return nil, ErrTimeout
+	}
+	return c, nil
+}
+
+func (c *SocketClient) receive(ctx *cosnet.Context) any {
+	path, _, _ := ctx.Path()
+	msg := &Message{Path: path, Flag: ctx.Message.Flag(), Index: ctx.Message.Index()}
+	msg.Body = append(msg.Body, ctx.Message.Body()...)
+	if s, ok := gateway.Setting.S2CSecret.(string); ok && strings.TrimPrefix(path, "/") == strings.TrimPrefix(s, "/") {
+		c.locker.Lock()
+		c.Secret = msg.String()
+		c.locker.Unlock()
+	}
+	c.locker.Lock()
+	ch, ok := c.pending[msg.Index]
+	if ok {
+		delete(c.pending, msg.Index)
+	}
+	c.locker.Unlock()
+	if ok {
+		ch <- msg
+		return nil
+	}
+	select {
+	case c.messages <- msg:
+	default:
+		//测试代码没有及时读取推送消息,丢弃
+	}
+	return nil
+}
+
+// Request 发送请求并等待同一 Index 的返回,body 为 []byte 时直接发送,否则使用 JSON 序列化
+func (c *SocketClient) Request(path string, body any) (*Message, error) {
+	b, err := marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	rid := atomic.AddInt32(&c.index, 1)
+	ch := make(chan *Message, 1)
+	c.locker.Lock()
+	c.pending[rid] = ch
+	c.locker.Unlock()
+	if err = c.Socket.Send(0, rid, path, b); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(Timeout):
+		c.locker.Lock()
+		delete(c.pending, rid)
+		c.locker.Unlock()
+		return nil, ErrTimeout
+	}
+}
+
+// Wait 等待服务器推送,path 为空时返回任意推送
+func (c *SocketClient) Wait(path string, timeout ...time.Duration) (*Message, error) {
+	d := Timeout
+	if len(timeout) > 0 {
+		d = timeout[0]
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	for {
+		select {
+		case msg := <-c.messages:
+			if path == "" || strings.TrimPrefix(msg.Path, "/") == strings.TrimPrefix(path, "/") {
+				return msg, nil
+			}
+		case <-t.C:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// OAuth 使用 gateway.Setting.C2SOAuth 登录,args 一般为 token.ArgsDefault
+// 登录成功后等待 S2CSecret 推送并记录在 Secret 中
+func (c *SocketClient) OAuth(args any) (*Message, error) {
+	msg, err := c.Request(gateway.Setting.C2SOAuth, args)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := gateway.Setting.S2CSecret.(string); ok && c.GetSecret() == "" {
+		_, _ = c.Wait(s)
+	}
+	return msg, nil
+}
+
+// Reconnect 使用 S2CSecret 下发的秘钥断线重连
+func (c *SocketClient) Reconnect(secret string) (*Message, error) {
+	return c.Request(gateway.Setting.C2SReconnect, []byte(secret))
+}
+
+// Heartbeat 发送 gateway.Setting.C2SHeartbeat
+func (c *SocketClient) Heartbeat() (*Message, error) {
+	return c.Request(gateway.Setting.C2SHeartbeat, nil)
+}
+
+// GetSecret 最近一次收到的断线重连秘钥
+func (c *SocketClient) GetSecret() string {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.Secret
+}
+
+// Close 断开连接
+func (c *SocketClient) Close() {
+	c.Socket.Close()
+}
+
+// Session 网关中当前连接对应的登录信息
+func (c *SocketClient) Session() *session.Data {
+	return c.Socket.Data()
+}
+
+func marshal(body any) ([]byte, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// connListener 只返回一个连接的 Listener,让 cosnet 以客户端身份接管已经建立的连接
+type connListener struct {
+	conn   net.Conn
+	accept chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	ln := &connListener{conn: conn, accept: make(chan net.Conn, 1), closed: make(chan struct{})}
+	ln.accept <- conn
+	return ln
+}
+
+func (ln *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ln.accept:
+		return conn, nil
+	case <-ln.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (ln *connListener) Close() error {
+	ln.once.Do(func() {
+		close(ln.closed)
+	})
+	return nil
+}
+
+func (ln *connListener) Addr() net.Addr {
+	return ln.conn.LocalAddr()
+}
+
+// wsConn 将 websocket 二进制消息包装成 net.Conn
+type wsConn struct {
+	*websocket.Conn
+	reader io.Reader
+	locker sync.Mutex
+}
+
+func (c *wsConn) Read(b []byte) (n int, err error) {
+	for {
+		if c.reader == nil {
+			var t int
+			if t, c.reader, err = c.Conn.NextReader(); err != nil {
+				return 0, err
+			}
+			if t != websocket.BinaryMessage && t != websocket.TextMessage {
+				c.reader = nil
+				continue
+			}
+		}
+		n, err = c.reader.Read(b)
+		if errors.Is(err, io.EOF) {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if err := c.Conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
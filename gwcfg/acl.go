@@ -0,0 +1,142 @@
+package gwcfg
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ACL IP访问控制,支持单个IP和CIDR,IPv4 和 IPv6
+//
+//	[acl]
+//	deny = ["1.2.3.0/24"]
+//	allow = []
+//	developer = ["10.0.0.0/8", "fd00::/8"]
+type ACL struct {
+	Allow     []string `json:"allow"`     //允许访问的IP段,为空时不限制
+	Deny      []string `json:"deny"`      //禁止访问的IP段,优先于 Allow
+	Developer []string `json:"developer"` //开发者接口和GM登录允许的IP段,为空时不限制
+}
+
+var IPFilter = ipFilter{}
+
+type ipFilter struct {
+	config atomic.Pointer[ipRules]
+}
+
+type ipRules struct {
+	allow     []netip.Prefix
+	deny      []netip.Prefix
+	developer []netip.Prefix
+}
+
+// Load 检查并加载IP规则,全部成功后整体替换,失败时保留原规则
+func (this *ipFilter) Load(c *ACL) error {
+	apply, err := this.Prepare(c)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare 检查IP规则,返回的函数用于生效
+func (this *ipFilter) Prepare(c *ACL) (apply func(), err error) {
+	r := &ipRules{}
+	if c != nil {
+		if r.allow, err = parsePrefixes("allow", c.Allow); err != nil {
+			return
+		}
+		if r.deny, err = parsePrefixes("deny", c.Deny); err != nil {
+			return
+		}
+		if r.developer, err = parsePrefixes("developer", c.Developer); err != nil {
+			return
+		}
+	}
+	return func() { this.config.Store(r) }, nil
+}
+
+// Allow 是否允许 ip 访问网关,ip 无法解析时只有没有配置规则才允许
+func (this *ipFilter) Allow(ip string) bool {
+	r := this.config.Load()
+	if r == nil || (len(r.allow) == 0 && len(r.deny) == 0) {
+		return true
+	}
+	addr, ok := ParseIP(ip)
+	if !ok {
+		return false
+	}
+	if containsAddr(r.deny, addr) {
+		return false
+	}
+	return len(r.allow) == 0 || containsAddr(r.allow, addr)
+}
+
+// Developer 是否允许 ip 访问开发者接口和使用GM登录
+func (this *ipFilter) Developer(ip string) bool {
+	r := this.config.Load()
+	if r == nil || len(r.developer) == 0 {
+		return true
+	}
+	addr, ok := ParseIP(ip)
+	return ok && containsAddr(r.developer, addr)
+}
+
+// ParseIP 解析IP,支持带端口的地址,IPv4-mapped IPv6 转换成 IPv4
+func ParseIP(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.Trim(s, "[]")
+	if i := strings.Index(s, "%"); i > 0 {
+		s = s[:i] //zone
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// RemoteIP 去掉地址中的端口,ip:port,[ipv6]:port
+func RemoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func parsePrefixes(name string, ss []string) (r []netip.Prefix, err error) {
+	for _, s := range ss {
+		var p netip.Prefix
+		if strings.Contains(s, "/") {
+			if p, err = netip.ParsePrefix(s); err != nil {
+				return nil, fmt.Errorf("acl %s error:%s", name, s)
+			}
+		} else {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(s); err != nil {
+				return nil, fmt.Errorf("acl %s error:%s", name, s)
+			}
+			addr = addr.Unmap()
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		r = append(r, p.Masked())
+	}
+	return
+}
+
+func containsAddr(ps []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range ps {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
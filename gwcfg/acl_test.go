@@ -0,0 +1,68 @@
+package gwcfg
+
+import "testing"
+
+func TestIPFilter(t *testing.T) {
+	defer IPFilter.config.Store(nil)
+	if !IPFilter.Allow("bad ip") {
+		t.Fatal("no rules should allow everything")
+	}
+	for _, c := range []*ACL{{Allow: []string{"10.0.0.0/33"}}, {Deny: []string{"abc"}}, {Developer: []string{"1.1.1"}}} {
+		if err := IPFilter.Load(c); err == nil {
+			t.Fatalf("%+v should fail", c)
+		}
+	}
+	err := IPFilter.Load(&ACL{
+		Allow:     []string{"10.0.0.0/8", "2001:db8::/32", "::ffff:192.168.1.0/120"},
+		Deny:      []string{"10.1.0.0/16", "10.2.3.4"},
+		Developer: []string{"10.9.0.0/16", "fd00::/8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		ip        string
+		allow     bool
+		developer bool
+	}{
+		{"10.0.0.1", true, false},
+		{"10.0.0.1:8080", true, false},
+		{"10.1.2.3", false, false}, //deny 优先
+		{"10.2.3.4", false, false},
+		{"10.2.3.5", true, false},
+		{"8.8.8.8", false, false},
+		{"192.168.1.9", true, false},     //IPv4-mapped 规则
+		{"::ffff:10.0.0.1", true, false}, //IPv4-mapped 地址
+		{"[2001:db8::1]:443", true, false},
+		{"fe80::1%eth0", false, false},
+		{"10.9.1.1", true, true},
+		{"fd00::1", false, true},
+		{"", false, false},
+	}
+	for _, c := range cases {
+		if v := IPFilter.Allow(c.ip); v != c.allow {
+			t.Errorf("%q allow:%v want:%v", c.ip, v, c.allow)
+		}
+		if v := IPFilter.Developer(c.ip); v != c.developer {
+			t.Errorf("%q developer:%v want:%v", c.ip, v, c.developer)
+		}
+	}
+	// 加载失败时保留原规则
+	if err = IPFilter.Load(&ACL{Deny: []string{"x"}}); err == nil || IPFilter.Allow("8.8.8.8") {
+		t.Fatal("broken config should keep old rules")
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	cases := map[string]string{
+		"1.2.3.4:80":    "1.2.3.4",
+		"1.2.3.4":       "1.2.3.4",
+		"[::1]:80":      "::1",
+		"[2001:db8::1]": "2001:db8::1",
+	}
+	for addr, want := range cases {
+		if v := RemoteIP(addr); v != want {
+			t.Errorf("%s:%s want:%s", addr, v, want)
+		}
+	}
+}
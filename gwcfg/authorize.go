@@ -3,6 +3,7 @@ package gwcfg
 import (
 	"path"
 	"strings"
+	"sync/atomic"
 )
 
 // 接口权限设置
@@ -16,13 +17,16 @@ const (
 	OAuthTypePlayer                  // 需要选择角色,并进入用户协程 默认
 )
 
-var Authorize = authorize{dict: map[string]OAuthType{}, prefix: map[string]OAuthType{}, v: OAuthTypePlayer}
+var Authorize = authorize{v: OAuthTypePlayer}
 
+// authorize 代码中注册的规则使用路由树匹配,支持 * 单段通配,结果与注册顺序无关
 type authorize struct {
-	v         OAuthType //默认
-	dict      map[string]OAuthType
-	prefix    map[string]OAuthType //按前缀匹配
-	developer map[string]struct{}  //开发者模式，想要启用开发者,GM模式才能使用
+	v          OAuthType //默认
+	oauth      trie[OAuthType]
+	developer  trie[bool]              //开发者模式，想要启用开发者,GM模式才能使用
+	permission trie[string]            //接口需要的权限
+	roles      map[string][]string     //角色拥有的权限
+	config     atomic.Pointer[ruleset] //配置文件中的规则,优先使用
 }
 
 func (auth *authorize) Format(s ...string) string {
@@ -42,30 +46,38 @@ func (auth *authorize) Format(s ...string) string {
 	return r
 }
 
+// Set 精确匹配,路由中可以使用 * 匹配任意一段
 func (auth *authorize) Set(servicePath, serviceMethod string, i OAuthType) {
 	r := auth.Format(servicePath, serviceMethod)
-	auth.dict[r] = i
+	auth.oauth.insert(r, false, i)
 }
 
 func (auth *authorize) Get(s ...string) (v OAuthType, path string) {
 	path = auth.Format(s...)
-	var ok bool
-	if v, ok = auth.dict[path]; ok {
-		return
+	v, _ = auth.getOAuth(path)
+	return
+}
+
+func (auth *authorize) getOAuth(path string) (OAuthType, Match) {
+	if r := auth.config.Load().get(path, ruleOAuth); r != nil {
+		return *r.OAuth, Match{Route: r.Route, Source: MatchSourceConfig}
 	}
-	var k string
-	for k, v = range auth.prefix {
-		if strings.HasPrefix(path, k) {
-			return
-		}
+	if l := auth.oauth.match(path); l != nil {
+		return l.value, Match{Route: l.route, Source: MatchSourceCode}
 	}
-	v = auth.v
-	return
+	return auth.v, Match{Source: MatchSourceDefault}
 }
 
+// Prefix 按字符串前缀匹配,最长前缀优先,Prefix("game", "gm") 匹配 /game/gm,/game/gmtool
 func (auth *authorize) Prefix(servicePath, serviceMethod string, i OAuthType) {
 	r := auth.Format(servicePath, serviceMethod)
-	auth.prefix[r] = i
+	auth.oauth.insertString(r, i)
+}
+
+// PrefixSegment 按路径分段前缀匹配,匹配自身以及所有子路径,PrefixSegment("game", "gm") 不匹配 /game/gmtool
+func (auth *authorize) PrefixSegment(servicePath, serviceMethod string, i OAuthType) {
+	r := auth.Format(servicePath, serviceMethod)
+	auth.oauth.insert(r, true, i)
 }
 
 // Default 设置,获取默认值
@@ -76,19 +88,96 @@ func (auth *authorize) Default(l ...OAuthType) OAuthType {
 	return auth.v
 }
 
-// SetMaster 前缀模式匹配
+// SetMaster 前缀模式匹配,按字符串前缀
 func (auth *authorize) SetMaster(servicePath string, serviceMethod string) {
-	if auth.developer == nil {
-		auth.developer = map[string]struct{}{}
-	}
 	r := auth.Format(servicePath, serviceMethod)
-	auth.developer[r] = struct{}{}
+	auth.developer.insertString(r, true)
+}
+
+// SetMasterSegment 按路径分段前缀匹配的 SetMaster
+func (auth *authorize) SetMasterSegment(servicePath string, serviceMethod string) {
+	r := auth.Format(servicePath, serviceMethod)
+	auth.developer.insert(r, true, true)
 }
 
 func (auth *authorize) IsMaster(path string) bool {
-	for p, _ := range auth.developer {
-		if strings.HasPrefix(path, p) {
-			return true
+	v, _ := auth.getMaster(path)
+	return v
+}
+
+func (auth *authorize) getMaster(path string) (bool, Match) {
+	if r := auth.config.Load().get(path, ruleDeveloper); r != nil {
+		return *r.Developer, Match{Route: r.Route, Source: MatchSourceConfig}
+	}
+	if l := auth.developer.match(path); l != nil {
+		return l.value, Match{Route: l.route, Source: MatchSourceCode}
+	}
+	return false, Match{Source: MatchSourceDefault}
+}
+
+// PermissionAll 拥有所有权限
+const PermissionAll = "*"
+
+// SetPermission 接口需要指定权限,session 中的角色(ServiceMetadataRole)必须拥有该权限
+func (auth *authorize) SetPermission(servicePath, serviceMethod string, permission string) {
+	r := auth.Format(servicePath, serviceMethod)
+	auth.permission.insert(r, false, permission)
+}
+
+// PrefixPermission 按字符串前缀设置需要的权限,最长前缀优先
+func (auth *authorize) PrefixPermission(servicePath, serviceMethod string, permission string) {
+	r := auth.Format(servicePath, serviceMethod)
+	auth.permission.insertString(r, permission)
+}
+
+// PrefixPermissionSegment 按路径分段前缀设置需要的权限
+func (auth *authorize) PrefixPermissionSegment(servicePath, serviceMethod string, permission string) {
+	r := auth.Format(servicePath, serviceMethod)
+	auth.permission.insert(r, true, permission)
+}
+
+// GetPermission 接口需要的权限,为空时不需要
+func (auth *authorize) GetPermission(path string) string {
+	v, _ := auth.getPermission(path)
+	return v
+}
+
+func (auth *authorize) getPermission(path string) (string, Match) {
+	if r := auth.config.Load().get(path, rulePermission); r != nil {
+		return r.Permission, Match{Route: r.Route, Source: MatchSourceConfig}
+	}
+	if l := auth.permission.match(path); l != nil {
+		return l.value, Match{Route: l.route, Source: MatchSourceCode}
+	}
+	return "", Match{Source: MatchSourceDefault}
+}
+
+// SetRole 设置角色拥有的权限,与配置 roles 合并
+func (auth *authorize) SetRole(role string, permissions ...string) {
+	if auth.roles == nil {
+		auth.roles = map[string][]string{}
+	}
+	auth.roles[role] = append(auth.roles[role], permissions...)
+}
+
+// HasPermission 角色中任意一个拥有权限即可
+func (auth *authorize) HasPermission(roles []string, permission string) bool {
+	return auth.hasPermission(roles, permission, true)
+}
+
+// HasExplicitPermission 角色中任意一个明确拥有权限,PermissionAll 不算
+func (auth *authorize) HasExplicitPermission(roles []string, permission string) bool {
+	return auth.hasPermission(roles, permission, false)
+}
+
+func (auth *authorize) hasPermission(roles []string, permission string, all bool) bool {
+	for _, role := range roles {
+		for _, ps := range [][]string{auth.roles[role], Options.Roles[role]} {
+			for _, p := range ps {
+				if p == permission || (all && p == PermissionAll) {
+					return true
+				}
+			}
 		}
 	}
 	return false
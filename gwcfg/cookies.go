@@ -8,6 +8,7 @@ func init() {
 	Cookies.Enable(ServiceMetadataUID)
 	Cookies.Enable(ServiceMetadataServerId)
 	Cookies.Enable(ServiceMetadataDeveloper)
+	Cookies.Enable(ServiceMetadataRole)
 }
 
 type cookiesAllowableName map[string]struct{}
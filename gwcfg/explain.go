@@ -0,0 +1,51 @@
+package gwcfg
+
+import "fmt"
+
+// 规则来源
+const (
+	MatchSourceConfig  = "config"  //配置文件 rules
+	MatchSourceCode    = "code"    //代码中注册
+	MatchSourceDefault = "default" //没有匹配的规则,使用默认值
+)
+
+// Match 命中的规则
+type Match struct {
+	Route  string `json:"route"`  //规则路由,前缀规则以 /* 结尾,默认值时为空
+	Source string `json:"source"` //config,code,default
+}
+
+func (m Match) String() string {
+	if m.Route == "" {
+		return m.Source
+	}
+	return m.Source + " " + m.Route
+}
+
+// Explain 路由最终生效的权限以及每一项命中的规则,用于排查权限配置
+type Explain struct {
+	Path            string    `json:"path"`
+	OAuth           OAuthType `json:"oauth"`
+	OAuthMatch      Match     `json:"oauthMatch"`
+	Developer       bool      `json:"developer"`
+	DeveloperMatch  Match     `json:"developerMatch"`
+	Protocol        protocol  `json:"protocol"`
+	ProtocolMatch   Match     `json:"protocolMatch"`
+	Permission      string    `json:"permission"`
+	PermissionMatch Match     `json:"permissionMatch"`
+}
+
+func (e *Explain) String() string {
+	return fmt.Sprintf("oauth:%d(%s) developer:%v(%s) protocol:%d(%s) permission:%s(%s)", e.OAuth, e.OAuthMatch, e.Developer, e.DeveloperMatch, e.Protocol, e.ProtocolMatch, e.Permission, e.PermissionMatch)
+}
+
+// Explain 说明路由命中的规则,path 为 /servicePath/serviceMethod
+func (auth *authorize) Explain(path string) *Explain {
+	path = auth.Format(path)
+	e := &Explain{Path: path}
+	e.OAuth, e.OAuthMatch = auth.getOAuth(path)
+	e.Developer, e.DeveloperMatch = auth.getMaster(path)
+	e.Protocol, e.ProtocolMatch = auth.getProtocol(path)
+	e.Permission, e.PermissionMatch = auth.getPermission(path)
+	return e
+}
@@ -0,0 +1,118 @@
+package gwcfg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hwcer/cosgo/values"
+)
+
+// 广播过滤,metadata 中 _msg_filter.<cookie> = 表达式,多个条件同时满足时推送,cookie 必须在 Cookies 中启用
+//
+//	_msg_filter.sid = 1001          等于
+//	_msg_filter.sid = 1001,1002     在列表中
+//	_msg_filter.ver = 1.2.*         前缀
+//	_msg_filter.lv  = 10~50         数值范围(包含两端),10~ 或 ~50 不限制一端
+//	_msg_filter.dev = *             不为空
+
+const (
+	filterEqual = iota
+	filterIn
+	filterPrefix
+	filterRange
+	filterExist
+)
+
+type filterCond struct {
+	key   string
+	op    int
+	value string
+	list  map[string]struct{}
+	min   float64
+	max   float64
+}
+
+// Filter 广播过滤条件,nil 时全部匹配
+type Filter []*filterCond
+
+// ParseFilter 解析 metadata 中的过滤条件,没有时返回 nil
+func ParseFilter(mate values.Metadata) (Filter, error) {
+	var r Filter
+	for k, v := range mate {
+		if !strings.HasPrefix(k, ServiceMessageFilter) {
+			continue
+		}
+		key := strings.TrimPrefix(k, ServiceMessageFilter)
+		if _, ok := Cookies[key]; !ok {
+			return nil, fmt.Errorf("broadcast filter cookie not enable:%s", key)
+		}
+		c, err := parseFilterCond(key, v)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, c)
+	}
+	return r, nil
+}
+
+func parseFilterCond(key, s string) (*filterCond, error) {
+	c := &filterCond{key: key, value: s}
+	switch {
+	case s == "*":
+		c.op = filterExist
+	case strings.Contains(s, "~"):
+		c.op = filterRange
+		a, b, _ := strings.Cut(s, "~")
+		c.min, c.max = math.Inf(-1), math.Inf(1)
+		var err error
+		if a = strings.TrimSpace(a); a != "" {
+			if c.min, err = strconv.ParseFloat(a, 64); err != nil {
+				return nil, fmt.Errorf("broadcast filter range error,%s:%s", key, s)
+			}
+		}
+		if b = strings.TrimSpace(b); b != "" {
+			if c.max, err = strconv.ParseFloat(b, 64); err != nil {
+				return nil, fmt.Errorf("broadcast filter range error,%s:%s", key, s)
+			}
+		}
+	case strings.Contains(s, ","):
+		c.op = filterIn
+		c.list = map[string]struct{}{}
+		for _, v := range strings.Split(s, ",") {
+			c.list[strings.TrimSpace(v)] = struct{}{}
+		}
+	case strings.HasSuffix(s, "*"):
+		c.op = filterPrefix
+		c.value = strings.TrimSuffix(s, "*")
+	}
+	return c, nil
+}
+
+// Match 玩家的 cookie 是否满足所有条件
+func (f Filter) Match(p interface{ GetString(string) string }) bool {
+	for _, c := range f {
+		if !c.match(p.GetString(c.key)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *filterCond) match(v string) bool {
+	switch c.op {
+	case filterExist:
+		return v != ""
+	case filterIn:
+		_, ok := c.list[v]
+		return ok
+	case filterPrefix:
+		return strings.HasPrefix(v, c.value)
+	case filterRange:
+		n, err := strconv.ParseFloat(v, 64)
+		return err == nil && n >= c.min && n <= c.max
+	default:
+		return v == c.value
+	}
+}
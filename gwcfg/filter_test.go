@@ -0,0 +1,75 @@
+package gwcfg
+
+import (
+	"testing"
+
+	"github.com/hwcer/cosgo/values"
+)
+
+type filterPlayer map[string]string
+
+func (p filterPlayer) GetString(k string) string {
+	return p[k]
+}
+
+func TestParseFilter(t *testing.T) {
+	Cookies.Enable("lv")
+	Cookies.Enable("ver")
+	defer func() {
+		delete(Cookies, "lv")
+		delete(Cookies, "ver")
+	}()
+	if f, err := ParseFilter(values.Metadata{ServiceMessagePath: "notice"}); err != nil || f != nil {
+		t.Fatalf("no filter:%v %v", f, err)
+	}
+	for _, mate := range []values.Metadata{
+		{ServiceMessageFilter + "not_enable": "1"},
+		{ServiceMessageFilter + "lv": "a~10"},
+		{ServiceMessageFilter + "lv": "1~b"},
+	} {
+		if _, err := ParseFilter(mate); err == nil {
+			t.Fatalf("%v should fail", mate)
+		}
+	}
+	cases := []struct {
+		expr  string
+		value string
+		ok    bool
+	}{
+		{"1001", "1001", true},
+		{"1001", "1002", false},
+		{"1001, 1002", "1002", true},
+		{"1001,1002", "1003", false},
+		{"1.2.*", "1.2.3", true},
+		{"1.2.*", "1.3.0", false},
+		{"10~50", "10", true},
+		{"10~50", "50", true},
+		{"10~50", "51", false},
+		{"10~50", "abc", false},
+		{"10~", "1000", true},
+		{"~50", "-1", true},
+		{"~50", "", false},
+		{"*", "x", true},
+		{"*", "", false},
+	}
+	for _, c := range cases {
+		f, err := ParseFilter(values.Metadata{ServiceMessageFilter + "lv": c.expr})
+		if err != nil {
+			t.Fatalf("%s:%v", c.expr, err)
+		}
+		if v := f.Match(filterPlayer{"lv": c.value}); v != c.ok {
+			t.Errorf("%q match %q:%v want:%v", c.expr, c.value, v, c.ok)
+		}
+	}
+	// 多个条件同时满足
+	f, err := ParseFilter(values.Metadata{ServiceMessageFilter + "lv": "10~", ServiceMessageFilter + "ver": "1.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Match(filterPlayer{"lv": "20", "ver": "1.0"}) || f.Match(filterPlayer{"lv": "20", "ver": "2.0"}) {
+		t.Fatal("all conditions should match")
+	}
+	if !Filter(nil).Match(filterPlayer{}) {
+		t.Fatal("nil filter should match all")
+	}
+}
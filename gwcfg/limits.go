@@ -0,0 +1,109 @@
+package gwcfg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// 限流计数方式
+const (
+	LimitKeyIP   = "ip"   //按客户端IP
+	LimitKeyGUID = "guid" //按账号,没有登录时按IP
+	LimitKeyUID  = "uid"  //按角色,没有选择角色时按账号
+)
+
+var limitKeys = []string{LimitKeyIP, LimitKeyGUID, LimitKeyUID}
+
+// Limit 接口限流,令牌桶,每个 Key 单独计数
+//
+//	[[limits]]
+//	route = "/game/mail/*"
+//	key = "uid"
+//	rate = 5
+//	burst = 10
+type Limit struct {
+	Route string  `json:"route"` //同 Rule.Route
+	Key   string  `json:"key"`   //计数方式 LimitKeyXXX,默认 ip
+	Rate  float64 `json:"rate"`  //每秒允许的次数
+	Burst int     `json:"burst"` //允许瞬间并发的次数,0 时等于 Rate
+}
+
+// Capacity 令牌桶容量,至少为1
+func (l *Limit) Capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	if l.Rate > 1 {
+		return l.Rate
+	}
+	return 1
+}
+
+var Limits = limits{}
+
+// limits 按计数方式分别匹配,同一个接口可以同时按IP和账号限流
+type limits struct {
+	config atomic.Pointer[map[string]*trie[*Limit]]
+}
+
+// Load 检查并加载限流配置,全部成功后整体替换,失败时保留原配置
+func (this *limits) Load(ls []*Limit) error {
+	apply, err := this.Prepare(ls)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare 检查限流配置,返回的函数用于生效
+func (this *limits) Prepare(ls []*Limit) (func(), error) {
+	dict := map[string]*trie[*Limit]{}
+	for _, v := range ls {
+		if v.Route == "" {
+			return nil, fmt.Errorf("limits route empty")
+		}
+		if v.Rate <= 0 {
+			return nil, fmt.Errorf("limits rate error,route:%s", v.Route)
+		}
+		l := *v
+		if l.Key == "" {
+			l.Key = LimitKeyIP
+		}
+		if !slices.Contains(limitKeys, l.Key) {
+			return nil, fmt.Errorf("limits key error,route:%s,key:%s", v.Route, l.Key)
+		}
+		t := dict[l.Key]
+		if t == nil {
+			t = &trie[*Limit]{}
+			dict[l.Key] = t
+		}
+		prefix := strings.HasSuffix(l.Route, RuleWildcard)
+		l.Route = Authorize.Format(strings.TrimSuffix(l.Route, RuleWildcard))
+		if !t.insert(l.Route, prefix, &l) {
+			return nil, fmt.Errorf("limits route duplicate:%s,key:%s", v.Route, l.Key)
+		}
+		if prefix {
+			l.Route = strings.TrimSuffix(l.Route, "/") + RuleWildcard
+		}
+	}
+	return func() { this.config.Store(&dict) }, nil
+}
+
+// Match 路由匹配的限流规则,每种计数方式最多一条,最具体的规则优先
+func (this *limits) Match(path string) (r []*Limit) {
+	dict := this.config.Load()
+	if dict == nil {
+		return nil
+	}
+	for _, k := range limitKeys {
+		if t := (*dict)[k]; t != nil {
+			if l := t.match(path); l != nil {
+				r = append(r, l.value)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package gwcfg
+
+import "testing"
+
+func TestLimitsLoad(t *testing.T) {
+	defer Limits.config.Store(nil)
+	errs := [][]*Limit{
+		{{Route: "", Rate: 1}},
+		{{Route: "/game/*", Rate: 0}},
+		{{Route: "/game/*", Rate: 1, Key: "role"}},
+		{{Route: "/game/*", Rate: 1}, {Route: "game/*", Rate: 2, Key: LimitKeyIP}},
+	}
+	for i, ls := range errs {
+		if err := Limits.Load(ls); err == nil {
+			t.Fatalf("case %d should fail", i)
+		}
+	}
+	ls := []*Limit{
+		{Route: "/game/*", Rate: 10},
+		{Route: "/game/mail/*", Rate: 5},
+		{Route: "/game/mail/send", Key: LimitKeyUID, Rate: 1},
+		{Route: "/game/*", Key: LimitKeyGUID, Rate: 20},
+	}
+	if err := Limits.Load(ls); err != nil {
+		t.Fatal(err)
+	}
+	// 加载失败时保留原配置
+	if err := Limits.Load(errs[0]); err == nil {
+		t.Fatal("empty route should fail")
+	}
+	cases := []struct {
+		path  string
+		rates []float64 //按 ip,guid,uid 顺序
+	}{
+		{"/game/mail/send", []float64{5, 20, 1}},
+		{"/game/mail/list", []float64{5, 20}},
+		{"/game/role/info", []float64{10, 20}},
+		{"/chat/send", nil},
+	}
+	for _, c := range cases {
+		r := Limits.Match(c.path)
+		if len(r) != len(c.rates) {
+			t.Fatalf("%s matched %d", c.path, len(r))
+		}
+		for i, l := range r {
+			if l.Rate != c.rates[i] {
+				t.Fatalf("%s limit %d rate:%v want:%v", c.path, i, l.Rate, c.rates[i])
+			}
+		}
+	}
+	if ls[0].Key != "" || ls[0].Route != "/game/*" {
+		t.Fatal("load should not modify config")
+	}
+}
+
+func TestLimitCapacity(t *testing.T) {
+	cases := []struct {
+		l    Limit
+		want float64
+	}{
+		{Limit{Rate: 5, Burst: 10}, 10},
+		{Limit{Rate: 5}, 5},
+		{Limit{Rate: 0.5}, 1},
+	}
+	for _, c := range cases {
+		if v := c.l.Capacity(); v != c.want {
+			t.Fatalf("%+v capacity:%v want:%v", c.l, v, c.want)
+		}
+	}
+}
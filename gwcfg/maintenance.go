@@ -0,0 +1,181 @@
+package gwcfg
+
+import (
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/errors"
+)
+
+// Maintenance 维护模式,开发者始终可以进入
+//
+//	[maintain]
+//	start = 1767225600
+//	end = 1767229200
+//	notice = "停服维护"
+//	guid = ["tester"]
+//	ip = ["10.0.0.0/8"]
+//	notify = 600
+//	kick = true
+type Maintenance struct {
+	Enable bool     `json:"enable"` //立即进入维护,与 Options.Maintenance 相同
+	Start  int64    `json:"start"`  //计划开始时间(秒),0-不使用计划
+	End    int64    `json:"end"`    //结束时间(秒),0-手动结束
+	Notice string   `json:"notice"` //维护公告,随 ErrServerMaintenance 返回
+	Guid   []string `json:"guid"`   //维护期间允许进入的账号
+	IP     []string `json:"ip"`     //维护期间允许进入的IP段
+	Notify int64    `json:"notify"` //计划开始前多少秒给在线玩家推送维护公告,0-不推送
+	Kick   bool     `json:"kick"`   //开始时断开白名单以外的玩家
+}
+
+// MaintenanceNotice 维护公告,ErrServerMaintenance 和维护推送的内容
+type MaintenanceNotice struct {
+	Notice string `json:"notice"`
+	Start  int64  `json:"start"`
+	End    int64  `json:"end"` //预计结束时间,0-未知
+}
+
+// Active 是否处于维护中
+func (m *Maintenance) Active(now int64) bool {
+	if m == nil {
+		return false
+	}
+	if m.End > 0 && now >= m.End {
+		return false
+	}
+	return m.Enable || (m.Start > 0 && now >= m.Start)
+}
+
+// Payload 维护公告
+func (m *Maintenance) Payload() *MaintenanceNotice {
+	return &MaintenanceNotice{Notice: m.Notice, Start: m.Start, End: m.End}
+}
+
+var Maintain = maintain{}
+
+// maintain 维护模式控制,RPC 设置的规则优先于配置文件,重置后恢复使用配置文件
+type maintain struct {
+	config  atomic.Pointer[maintenanceRules]
+	runtime atomic.Pointer[maintenanceRules]
+}
+
+type maintenanceRules struct {
+	*Maintenance
+	ip   []netip.Prefix
+	guid map[string]struct{}
+}
+
+func newMaintenanceRules(m *Maintenance) (*maintenanceRules, error) {
+	r := &maintenanceRules{Maintenance: m, guid: map[string]struct{}{}}
+	var err error
+	if r.ip, err = parsePrefixes("maintain ip", m.IP); err != nil {
+		return nil, err
+	}
+	if m.Start > 0 && m.End > 0 && m.End <= m.Start {
+		return nil, fmt.Errorf("maintain end must be greater than start")
+	}
+	for _, v := range m.Guid {
+		r.guid[v] = struct{}{}
+	}
+	return r, nil
+}
+
+// Load 加载配置文件,enable 为 Options.Maintenance
+func (this *maintain) Load(m *Maintenance, enable bool) error {
+	apply, err := this.Prepare(m, enable)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare 检查配置文件中的维护设置,返回的函数用于生效
+func (this *maintain) Prepare(m *Maintenance, enable bool) (func(), error) {
+	v := Maintenance{}
+	if m != nil {
+		v = *m
+	}
+	v.Enable = v.Enable || enable
+	r, err := newMaintenanceRules(&v)
+	if err != nil {
+		return nil, err
+	}
+	return func() { this.config.Store(r) }, nil
+}
+
+// Set 运行时设置维护模式,nil 时恢复使用配置文件
+func (this *maintain) Set(m *Maintenance) error {
+	if m == nil {
+		this.runtime.Store(nil)
+		return nil
+	}
+	v := *m
+	r, err := newMaintenanceRules(&v)
+	if err != nil {
+		return err
+	}
+	this.runtime.Store(r)
+	return nil
+}
+
+func (this *maintain) rules() *maintenanceRules {
+	if r := this.runtime.Load(); r != nil {
+		return r
+	}
+	return this.config.Load()
+}
+
+// Get 当前生效的维护设置,runtime 是否运行时设置
+func (this *maintain) Get() (m *Maintenance, runtime bool) {
+	if r := this.runtime.Load(); r != nil {
+		return r.Maintenance, true
+	}
+	if r := this.config.Load(); r != nil {
+		return r.Maintenance, false
+	}
+	return nil, false
+}
+
+// Active 当前是否处于维护中
+func (this *maintain) Active() bool {
+	r := this.rules()
+	return r != nil && r.Active(time.Now().Unix())
+}
+
+// Allow 维护期间是否允许进入,guid 为空时只检查IP
+func (this *maintain) Allow(guid, ip string) bool {
+	r := this.rules()
+	if r == nil {
+		return true
+	}
+	if _, ok := r.guid[guid]; ok && guid != "" {
+		return true
+	}
+	if len(r.ip) > 0 {
+		if addr, ok := ParseIP(ip); ok && containsAddr(r.ip, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify 维护期间不在白名单时返回带维护公告的 ErrServerMaintenance
+func (this *maintain) Verify(guid, ip string) error {
+	if !this.Active() || this.Allow(guid, ip) {
+		return nil
+	}
+	return this.Error()
+}
+
+// Error 带维护公告的 ErrServerMaintenance
+func (this *maintain) Error() error {
+	r := this.rules()
+	if r == nil {
+		return errors.ErrServerMaintenance
+	}
+	return &values.Message{Code: errors.ErrServerMaintenance.Code, Data: r.Payload()}
+}
@@ -0,0 +1,116 @@
+package gwcfg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/errors"
+)
+
+func TestMaintenanceActive(t *testing.T) {
+	cases := []struct {
+		m    *Maintenance
+		now  int64
+		want bool
+	}{
+		{nil, 100, false},
+		{&Maintenance{}, 100, false},
+		{&Maintenance{Enable: true}, 100, true},
+		{&Maintenance{Enable: true, End: 100}, 100, false}, //到达结束时间后自动结束
+		{&Maintenance{Start: 100}, 99, false},
+		{&Maintenance{Start: 100}, 100, true},
+		{&Maintenance{Start: 100, End: 200}, 199, true},
+		{&Maintenance{Start: 100, End: 200}, 200, false},
+	}
+	for i, c := range cases {
+		if v := c.m.Active(c.now); v != c.want {
+			t.Errorf("case %d active:%v want:%v", i, v, c.want)
+		}
+	}
+}
+
+func TestMaintainLoad(t *testing.T) {
+	m := &maintain{}
+	if m.Active() || !m.Allow("", "") {
+		t.Fatal("no config should not be in maintenance")
+	}
+	if err := m.Load(&Maintenance{Start: 200, End: 100}, false); err == nil {
+		t.Fatal("end before start should fail")
+	}
+	if err := m.Load(&Maintenance{IP: []string{"bad"}}, false); err == nil {
+		t.Fatal("bad ip should fail")
+	}
+	// Options.Maintenance 等同于 enable
+	if err := m.Load(&Maintenance{Notice: "config"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if v, runtime := m.Get(); !m.Active() || runtime || v.Notice != "config" {
+		t.Fatalf("config maintenance:%+v runtime:%v", v, runtime)
+	}
+	// 运行时设置优先于配置文件,Reload 不覆盖运行时设置
+	if err := m.Set(&Maintenance{Notice: "runtime"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(&Maintenance{Notice: "reload"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if v, runtime := m.Get(); m.Active() || !runtime || v.Notice != "runtime" {
+		t.Fatalf("runtime maintenance:%+v runtime:%v", v, runtime)
+	}
+	if err := m.Set(&Maintenance{Start: 200, End: 100}); err == nil {
+		t.Fatal("end before start should fail")
+	}
+	if v, _ := m.Get(); v.Notice != "runtime" {
+		t.Fatal("failed set should keep runtime maintenance")
+	}
+	// 重置后恢复使用配置文件
+	if err := m.Set(nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, runtime := m.Get(); !m.Active() || runtime || v.Notice != "reload" {
+		t.Fatalf("reset maintenance:%+v runtime:%v", v, runtime)
+	}
+}
+
+func TestMaintainAllow(t *testing.T) {
+	m := &maintain{}
+	now := time.Now().Unix()
+	err := m.Set(&Maintenance{Start: now - 10, End: now + 100, Notice: "update", Guid: []string{"tester"}, IP: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		guid string
+		ip   string
+		want bool
+	}{
+		{"tester", "1.1.1.1", true},
+		{"", "10.1.2.3", true},
+		{"player", "10.1.2.3:8080", true},
+		{"player", "1.1.1.1", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		if v := m.Allow(c.guid, c.ip); v != c.want {
+			t.Errorf("%s %s allow:%v want:%v", c.guid, c.ip, v, c.want)
+		}
+	}
+	if m.Verify("tester", "") != nil {
+		t.Fatal("whitelist should pass")
+	}
+	e, ok := m.Verify("player", "1.1.1.1").(*values.Message)
+	if !ok || e.Code != errors.ErrServerMaintenance.Code {
+		t.Fatalf("verify error:%v", e)
+	}
+	if n, ok := e.Data.(*MaintenanceNotice); !ok || n.Notice != "update" || n.End != now+100 {
+		t.Fatalf("maintenance notice:%+v", e.Data)
+	}
+	// 维护时间之外不检查白名单
+	if err = m.Set(&Maintenance{Start: now + 100}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Verify("player", "1.1.1.1") != nil {
+		t.Fatal("scheduled maintenance not started")
+	}
+}
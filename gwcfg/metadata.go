@@ -4,17 +4,28 @@ const (
 	ServiceMetadataUID        = "uid"
 	ServiceMetadataGUID       = "guid"
 	ServiceMetadataServerId   = "sid"
-	ServiceMetadataDeveloper  = "dev" //开发者身份
-	ServiceMetadataPermission = "per" //接口等级
+	ServiceMetadataDeveloper  = "dev"  //开发者身份,开发者名称
+	ServiceMetadataRole       = "role" //角色,多个角色使用逗号分隔
+	ServiceMetadataPermission = "per"  //接口等级
 
 	ServiceMetadataSocketId  = "sock"
 	ServiceMetadataGateway   = "gate"
 	ServiceMetadataClientIp  = "_uip"
 	ServiceMetadataRequestId = "_rid" //Request id
 
-	ServiceMessagePath    = "_msg_path"
-	ServiceMessageIgnore  = "_msg_ignore"
-	ServiceMessageChannel = "_msg_channel"
+	ServiceMessagePath     = "_msg_path"
+	ServiceMessageIgnore   = "_msg_ignore"
+	ServiceMessageChannel  = "_msg_channel"
+	ServiceMessageGUID     = "_msg_guid"     //multicast 玩家GUID列表,逗号分隔
+	ServiceMessageUID      = "_msg_uid"      //multicast 玩家UID列表,逗号分隔
+	ServiceMessageFilter   = "_msg_filter."  //broadcast 过滤条件前缀,见 ParseFilter
+	ServiceMessageWait     = "_msg_wait"     //broadcast 等待推送完成并返回推送结果
+	ServiceMessageBuffer   = "_msg_buffer"   //send,multicast 长连接暂时断开时缓存,重连后补发
+	ServiceMessageLow      = "_msg_low"      //低优先级推送,积压时优先丢弃
+	ServiceMessageConflate = "_msg_conflate" //合并 key,积压时相同 key 只保留最新的一条,为空时使用 path
+
+	ServiceKickCode  = "_kick_code"  //踢下线原因,错误码,默认 errors.ErrKicked
+	ServiceKickBlock = "_kick_block" //禁止断线重连的时间(秒),默认 Options.Kick
 
 	ServicePlayerLogin  = "_player_login"
 	ServicePlayerLogout = "_player_logout"
@@ -1,6 +1,8 @@
 package gwcfg
 
 import (
+	"encoding/json"
+
 	"github.com/hwcer/cosgo/binder"
 )
 
@@ -9,6 +11,8 @@ const (
 	MessageSend             = "send"
 	MessageWrite            = "write"
 	MessageBroadcast        = "broadcast"
+	MessageMulticast        = "multicast"
+	MessageKick             = "kick"
 	MessageChannelDelete    = "channel/delete"
 	MessageChannelBroadcast = "channel/broadcast"
 )
@@ -19,6 +23,7 @@ const (
 	ProtocolTypeWSS  int8 = 1 << 0
 	ProtocolTypeTCP  int8 = 1 << 1
 	ProtocolTypeHTTP int8 = 1 << 2
+	ProtocolTypeKCP  int8 = 1 << 3 //KCP 长连接,使用独立的 UDP 端口,不参与 cmux
 )
 
 func (p protocol) Has(t int8) bool {
@@ -26,6 +31,11 @@ func (p protocol) Has(t int8) bool {
 	return v|t == v
 }
 
+// Allow 接口规则是否允许协议,0-不限制; KCP 与 TCP 使用相同的协议格式,允许 TCP 时同样允许 KCP
+func (p protocol) Allow(t int8) bool {
+	return p == 0 || p.Has(t) || (t == ProtocolTypeKCP && p.Has(ProtocolTypeTCP))
+}
+
 // CMux 是否启动 cmux 模块
 func (p protocol) CMux() bool {
 	var v int8
@@ -48,6 +58,35 @@ type config struct {
 	Websocket string   `json:"websocket"` //开启websocket时,路由前缀
 	KeyFile   string   `json:"KeyFile"`   //HTTPS 证书KEY
 	CertFile  string   `json:"CertFile"`  //HTTPS 证书Cert
+	KCP       *KCP     `json:"kcp"`       //KCP 长连接参数
+}
+
+// KCP 长连接参数,含义参考 kcp-go,客户端需要使用相同的 FEC 分片配置
+//
+//	[gate.kcp]
+//	address = ":8000"
+//	nodelay = 1
+//	interval = 10
+//	resend = 2
+//	nc = 1
+//	sndwnd = 256
+//	rcvwnd = 256
+//	datashards = 10
+//	parityshards = 3
+type KCP struct {
+	Address      string `json:"address"`      //UDP监听地址,为空时使用 gate.address
+	NoDelay      int    `json:"nodelay"`      //1-开启 nodelay
+	Interval     int    `json:"interval"`     //内部刷新间隔(毫秒)
+	Resend       int    `json:"resend"`       //快速重传,0-关闭
+	NC           int    `json:"nc"`           //1-关闭拥塞控制
+	SndWnd       int    `json:"sndwnd"`       //发送窗口(包)
+	RcvWnd       int    `json:"rcvwnd"`       //接收窗口(包)
+	MTU          int    `json:"mtu"`          //0-使用默认值
+	AckNoDelay   bool   `json:"acknodelay"`   //收到数据立即回复 ACK
+	DataShards   int    `json:"datashards"`   //FEC 数据分片,0-关闭 FEC
+	ParityShards int    `json:"parityshards"` //FEC 校验分片
+	ReadBuffer   int    `json:"readbuffer"`   //UDP 读缓冲(字节),0-使用系统默认值
+	WriteBuffer  int    `json:"writebuffer"`  //UDP 写缓冲(字节),0-使用系统默认值
 }
 
 var Gateway = &config{
@@ -56,18 +95,61 @@ var Gateway = &config{
 	Capacity:  10240,
 	Protocol:  2,
 	Websocket: "",
+	KCP:       &KCP{NoDelay: 1, Interval: 10, Resend: 2, NC: 1, SndWnd: 256, RcvWnd: 256},
+}
+
+// Config 网关配置,Options 的类型
+type Config struct {
+	Gate        *config             `json:"gate"`
+	Appid       string              `json:"appid"`      //程序名称
+	Secret      string              `json:"secret"`     //平台秘钥
+	Secrets     []*SecretKey        `json:"secrets"`    //平台秘钥轮换,按 ID 选择秘钥,与 Secret 同时生效
+	Verifier    map[string]string   `json:"verifier"`   //按签发凭证的 appid 选择验证方式: gcm(默认),jwt,any; 配置的 appid 同样允许登录
+	PublicKeys  []*PublicKey        `json:"publickeys"` //jwt 验证公钥
+	Replay      *Replay             `json:"replay"`     //登录凭证防重放
+	Binder      string              `json:"binder"`
+	Developer   string              `json:"developer"`   //开发者模式秘钥,所有开发者共用,建议使用 Developers
+	Developers  []*Developer        `json:"developers"`  //具名开发者账号
+	Roles       map[string][]string `json:"roles"`       //角色拥有的权限,与 Authorize.SetRole 合并
+	Rules       []*Rule             `json:"rules"`       //接口权限规则,与代码中注册的规则合并,Reload 时重新加载
+	Limits      []*Limit            `json:"limits"`      //接口限流,Reload 时重新加载
+	Connect     *Connect            `json:"connect"`     //长连接数量和消息频率限制
+	ACL         *ACL                `json:"acl"`         //IP访问控制,Reload 时重新加载
+	Maintenance bool                `json:"maintenance"` //进入维护模式，仅仅开发人员允许进入,与 Maintain.Enable 相同
+	Maintain    *Maintenance        `json:"maintain"`    //维护模式白名单,计划时间和公告,运行时可以通过 RPC maintenance 修改
+	Drain       *Drain              `json:"drain"`       //平滑关闭
+	Kick        int64               `json:"kick"`        //被踢下线后禁止使用旧的重连秘钥的时间(秒),0-不禁止
+	Broadcast   *Broadcast          `json:"broadcast"`   //异步广播,修改后需要重启
+	Outbound    *Outbound           `json:"outbound"`    //长连接推送积压限制
+	Pending     *Pending            `json:"pending"`     //长连接断开期间的推送缓存
+	Reliable    *Reliable           `json:"reliable"`    //可靠推送,序号,确认和断线补发
+	Poll        *Poll               `json:"poll"`        //HTTP推送(长轮询/SSE)
+}
+
+var Options = Config{
+	Gate:      Gateway,
+	Binder:    binder.Json.Name(),
+	Replay:    &Replay{Window: 3600, Capacity: 100000},
+	Drain:     &Drain{Timeout: 10},
+	Kick:      300,
+	Broadcast: &Broadcast{Queue: 64, Timeout: 1000, Wait: 10},
+	Poll:      &Poll{Messages: 200, Bytes: 512 << 10, Wait: 30, Idle: 60, Keepalive: 15},
+	Reliable:  &Reliable{Messages: 1000, Bytes: 1 << 20, Expire: 300},
+	Pending:   &Pending{Messages: 100, Bytes: 256 << 10, Expire: 60},
+	Outbound:  &Outbound{Messages: 1000, Bytes: 4 << 20, Policy: OutboundPolicyDrop, Interval: 100},
 }
 
-var Options = struct {
-	Gate        *config `json:"gate"`
-	Appid       string  `json:"appid"`  //程序名称
-	Secret      string  `json:"secret"` //平台秘钥
-	Binder      string  `json:"binder"`
-	Developer   string  `json:"developer"`   //开发者模式秘钥
-	Maintenance bool    `json:"maintenance"` //进入维护模式，仅仅开发人员允许进入
-}{
-	Gate:   Gateway,
-	Binder: binder.Json.Name(),
+// Clone 深度复制配置,Reload 时在副本上解析和检查,全部通过后再替换 Options
+func (c *Config) Clone() (*Config, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	r := &Config{}
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 type Static struct {
@@ -75,3 +157,127 @@ type Static struct {
 	Route string `json:"route"` //静态服务器器前缀
 	Index string `json:"index"` //默认页面
 }
+
+// 登录凭证防重放策略
+const (
+	ReplayPolicyNone   = ""       //不检查
+	ReplayPolicyStrict = "strict" //只能使用一次
+	ReplayPolicyIP     = "ip"     //同一IP允许重复使用
+)
+
+// Replay 登录凭证防重放,只检查带 nonce(jwt 中的 jti) 的凭证
+// 配置 gate.redis 时使用 redis 记录,否则使用内存
+type Replay struct {
+	Policy   string `json:"policy"`   //防重放策略 ReplayPolicyXXX
+	Window   int64  `json:"window"`   //凭证没有过期时间时的防重放时间(秒)
+	Capacity int    `json:"capacity"` //内存模式最多记录数量,超出时淘汰最早的记录
+}
+
+// Drain 平滑关闭,关闭期间健康检查返回 draining,新连接和新请求返回 ErrServerRestarting
+type Drain struct {
+	Delay   int64  `json:"delay"`   //开始关闭前等待负载均衡摘除的时间(秒)
+	Timeout int64  `json:"timeout"` //等待进行中请求的最长时间(秒)
+	Notice  string `json:"notice"`  //推送给所有连接的重启公告,随 ErrServerRestarting 发送
+}
+
+// Broadcast 异步广播队列,队列满时等待 Timeout 后返回 ErrBroadcastBusy
+type Broadcast struct {
+	Workers int   `json:"workers"` //推送协程数量,按 GUID 分片,0 时等于CPU数量
+	Queue   int   `json:"queue"`   //等待推送的广播数量上限
+	Timeout int64 `json:"timeout"` //队列满时等待的时间(毫秒)
+	Wait    int64 `json:"wait"`    //_msg_wait 等待推送完成的最长时间(秒)
+}
+
+// 推送积压超出限制时的处理策略
+const (
+	OutboundPolicyDrop       = "drop"       //丢弃低优先级推送,仍然超出时断开连接
+	OutboundPolicyConflate   = "conflate"   //合并相同 key 的推送,再丢弃低优先级推送,仍然超出时断开连接
+	OutboundPolicyDisconnect = "disconnect" //直接断开连接
+)
+
+// Outbound 长连接推送积压限制,发送缓冲已满的推送进入待发送队列,0-不限制
+type Outbound struct {
+	Messages int    `json:"messages"` //单个连接最多积压的推送数量
+	Bytes    int    `json:"bytes"`    //单个连接最多积压的字节数
+	Policy   string `json:"policy"`   //超出时的处理策略 OutboundPolicyXXX
+	Interval int64  `json:"interval"` //重试发送的间隔(毫秒),修改后需要重启
+}
+
+// Pending 长连接断开期间缓存带 _msg_buffer 的推送,断线重连后补发,超出时丢弃最早的推送
+type Pending struct {
+	Messages int   `json:"messages"` //单个玩家最多缓存的推送数量,0-不缓存
+	Bytes    int   `json:"bytes"`    //单个玩家最多缓存的字节数,0-不限制
+	Expire   int64 `json:"expire"`   //缓存时间(秒),0-不限制
+}
+
+// Reliable 可靠推送,每个会话保留未确认的推送用于断线重连后补发,超出时丢弃最早的推送,客户端需要全量同步
+type Reliable struct {
+	Enable   bool  `json:"enable"`   //允许客户端使用可靠推送,使用的会话推送的 Index 为 -seq,_msg_buffer 不再生效
+	Messages int   `json:"messages"` //单个玩家最多保留的未确认推送数量,0-不限制
+	Bytes    int   `json:"bytes"`    //单个玩家最多保留的字节数,0-不限制
+	Expire   int64 `json:"expire"`   //保留时间(秒),0-不限制
+}
+
+// Poll HTTP推送,两次轮询之间的推送保留在缓存中,超出时丢弃最早的推送
+type Poll struct {
+	Messages  int   `json:"messages"`  //单个玩家最多缓存的推送数量,0-不限制
+	Bytes     int   `json:"bytes"`     //单个玩家最多缓存的字节数,0-不限制
+	Wait      int64 `json:"wait"`      //长轮询最长等待时间(秒)
+	Idle      int64 `json:"idle"`      //超过多少秒没有轮询时删除缓存,不再接收推送,0-不删除
+	Keepalive int64 `json:"keepalive"` //SSE 心跳间隔(秒)
+}
+
+// Connect 长连接(TCP/WSS)限制,0-不限制,超出时推送 Setting.S2CDisconnect 后断开
+type Connect struct {
+	Max   int     `json:"max"`   //最大连接数
+	IP    int     `json:"ip"`    //单个IP最大连接数
+	Rate  float64 `json:"rate"`  //单个连接每秒消息数
+	Burst int     `json:"burst"` //单个连接允许瞬间发送的消息数,0 时等于 Rate
+}
+
+// Capacity 消息令牌桶容量,至少为1
+func (c *Connect) Capacity() float64 {
+	if c.Burst > 0 {
+		return float64(c.Burst)
+	}
+	if c.Rate > 1 {
+		return c.Rate
+	}
+	return 1
+}
+
+// SecretKey 带ID的平台秘钥,access 格式: ID:密文
+type SecretKey struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+	Start  int64  `json:"start"`  //生效时间(秒),0-立即生效
+	Expire int64  `json:"expire"` //停用时间(秒),0-永不停用
+}
+
+// Active 是否在有效期内
+func (k *SecretKey) Active(now int64) bool {
+	if k.Start > 0 && now < k.Start {
+		return false
+	}
+	if k.Expire > 0 && now >= k.Expire {
+		return false
+	}
+	return true
+}
+
+// Developer 具名开发者账号,登录后 session 中 ServiceMetadataDeveloper 为开发者名称
+type Developer struct {
+	Name   string   `json:"name"`
+	Secret string   `json:"secret"` //秘钥的 sha256,十六进制
+	Expire int64    `json:"expire"` //过期时间(秒),0-永不过期
+	Allow  []string `json:"allow"`  //允许登录的IP段(CIDR),为空时不限制
+	Role   string   `json:"role"`   //角色
+}
+
+// PublicKey jwt 签名验证公钥
+type PublicKey struct {
+	Id   string `json:"id"`   //对应 jwt header 中的 kid
+	Alg  string `json:"alg"`  //EdDSA,RS256
+	Key  string `json:"key"`  //PEM 格式公钥
+	File string `json:"file"` //PEM 公钥文件,Key 为空时使用
+}
@@ -0,0 +1,170 @@
+package gwcfg
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RuleWildcard 路由以 /* 结尾时按前缀匹配
+const RuleWildcard = "/*"
+
+// Rule 配置文件中声明的接口权限,优先级高于代码中注册的规则,未设置的字段继续匹配其他配置规则,都没有时使用代码规则
+//
+//	[[rules]]
+//	route = "/game/gm/*"
+//	oauth = 3
+//	developer = true
+//	protocol = 4
+//	permission = "gm.read"
+type Rule struct {
+	Route      string     `json:"route"`      // /servicePath/serviceMethod,以 /* 结尾时按前缀匹配,中间的 * 匹配任意一段
+	OAuth      *OAuthType `json:"oauth"`      //登录等级
+	Developer  *bool      `json:"developer"`  //仅开发者可以访问
+	Protocol   protocol   `json:"protocol"`   //允许的协议,0-不限制
+	Permission string     `json:"permission"` //需要的权限
+}
+
+func (r *Rule) prefix() bool {
+	return strings.HasSuffix(r.Route, RuleWildcard)
+}
+
+// 配置规则按设置的项分别建立路由树,每一项匹配设置了该项的最具体规则
+const (
+	ruleAll = iota
+	ruleOAuth
+	ruleDeveloper
+	ruleProtocol
+	rulePermission
+	ruleMax
+)
+
+// ruleset 配置规则,Reload 时整体替换
+type ruleset [ruleMax]trie[*Rule]
+
+func (rs *ruleset) insert(r *Rule, prefix bool) bool {
+	if !rs[ruleAll].insert(r.Route, prefix, r) {
+		return false
+	}
+	if r.OAuth != nil {
+		rs[ruleOAuth].insert(r.Route, prefix, r)
+	}
+	if r.Developer != nil {
+		rs[ruleDeveloper].insert(r.Route, prefix, r)
+	}
+	if r.Protocol != 0 {
+		rs[ruleProtocol].insert(r.Route, prefix, r)
+	}
+	if r.Permission != "" {
+		rs[rulePermission].insert(r.Route, prefix, r)
+	}
+	return true
+}
+
+func (rs *ruleset) get(path string, i int) *Rule {
+	if rs == nil {
+		return nil
+	}
+	if l := rs[i].match(path); l != nil {
+		return l.value
+	}
+	return nil
+}
+
+// Load 检查并加载配置规则,全部成功后整体替换,失败时保留原规则
+func (auth *authorize) Load(rs []*Rule) error {
+	apply, err := auth.Prepare(rs)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare 检查配置规则,返回的函数用于生效,Module.Reload 检查所有配置之后再统一生效
+func (auth *authorize) Prepare(rs []*Rule) (func(), error) {
+	r := &ruleset{}
+	for _, v := range rs {
+		if v.Route == "" {
+			return nil, fmt.Errorf("rules route empty")
+		}
+		if v.OAuth != nil && (*v.OAuth < OAuthTypeNone || *v.OAuth > OAuthTypePlayer) {
+			return nil, fmt.Errorf("rules oauth error,route:%s", v.Route)
+		}
+		rule := *v
+		prefix := rule.prefix()
+		rule.Route = auth.Format(strings.TrimSuffix(rule.Route, RuleWildcard))
+		if !r.insert(&rule, prefix) {
+			return nil, fmt.Errorf("rules route duplicate:%s", v.Route)
+		}
+		if prefix {
+			rule.Route = strings.TrimSuffix(rule.Route, "/") + RuleWildcard
+		}
+	}
+	return func() { auth.config.Store(r) }, nil
+}
+
+// Rule 路由匹配的配置规则,没有时返回nil
+func (auth *authorize) Rule(path string) *Rule {
+	return auth.config.Load().get(path, ruleAll)
+}
+
+// GetProtocol 接口允许的协议,0-不限制
+func (auth *authorize) GetProtocol(path string) protocol {
+	v, _ := auth.getProtocol(path)
+	return v
+}
+
+func (auth *authorize) getProtocol(path string) (protocol, Match) {
+	if r := auth.config.Load().get(path, ruleProtocol); r != nil {
+		return r.Protocol, Match{Route: r.Route, Source: MatchSourceConfig}
+	}
+	return 0, Match{Source: MatchSourceDefault}
+}
+
+// Report 按服务列出所有规则以及规则路径上最终生效的结果,用于启动时检查配置
+func (auth *authorize) Report(services []string) (r []string) {
+	r = append(r, fmt.Sprintf("default oauth:%d", auth.v))
+	type item struct {
+		route  string
+		source string
+	}
+	var items []item
+	for _, l := range auth.oauth.list() {
+		items = append(items, item{l.route, MatchSourceCode})
+	}
+	for _, l := range auth.developer.list() {
+		items = append(items, item{l.route, MatchSourceCode})
+	}
+	for _, l := range auth.permission.list() {
+		items = append(items, item{l.route, MatchSourceCode})
+	}
+	if rs := auth.config.Load(); rs != nil {
+		for _, l := range rs[ruleAll].list() {
+			items = append(items, item{l.route, MatchSourceConfig})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].route < items[j].route
+	})
+	var prefix []string
+	for _, s := range services {
+		prefix = append(prefix, auth.Format(s)+"/")
+	}
+	prefix = append(prefix, "/"+RouteWildcard)
+	seen := map[string]struct{}{}
+	for _, v := range items {
+		if !slices.ContainsFunc(prefix, func(p string) bool { return strings.HasPrefix(v.route, p) }) {
+			continue
+		}
+		k := v.route + v.source
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		path := strings.TrimSuffix(strings.TrimSuffix(v.route, RuleWildcard), RouteWildcard)
+		r = append(r, fmt.Sprintf("%s [%s] %s", v.route, v.source, auth.Explain(path)))
+	}
+	return
+}
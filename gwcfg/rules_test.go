@@ -0,0 +1,89 @@
+package gwcfg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRulesLoad(t *testing.T) {
+	auth := &authorize{v: OAuthTypeOAuth}
+	auth.Set("game", "login", OAuthTypeNone)
+	oauth, player, bad := OAuthTypeNone, OAuthTypePlayer, OAuthType(9)
+	developer := true
+	errs := [][]*Rule{
+		{{Route: ""}},
+		{{Route: "/game/*", OAuth: &bad}},
+		{{Route: "/game/*", Permission: "a"}, {Route: "game/*", Permission: "b"}},
+	}
+	for i, rs := range errs {
+		if err := auth.Load(rs); err == nil {
+			t.Fatalf("case %d should fail", i)
+		}
+	}
+	rs := []*Rule{
+		{Route: "/game/*", OAuth: &player},
+		{Route: "/game/gm/*", Developer: &developer, Permission: "gm"},
+		{Route: "/game/*/info", OAuth: &oauth},
+	}
+	if err := auth.Load(rs); err != nil {
+		t.Fatal(err)
+	}
+	// 加载失败时保留原规则
+	if err := auth.Load(errs[0]); err == nil {
+		t.Fatal("empty route should fail")
+	}
+	if v, _ := auth.Get("game/login"); v != OAuthTypePlayer {
+		t.Fatalf("config rule should override code rule:%d", v)
+	}
+	if v, _ := auth.Get("game/role/info"); v != OAuthTypeNone {
+		t.Fatalf("wildcard rule:%d", v)
+	}
+	if !auth.IsMaster("/game/gm/kick") || auth.GetPermission("/game/gm/kick") != "gm" {
+		t.Fatal("gm rule not loaded")
+	}
+	if v, _ := auth.Get("chat/send"); v != OAuthTypeOAuth {
+		t.Fatalf("default oauth:%d", v)
+	}
+	if rs[0].Route != "/game/*" {
+		t.Fatal("load should not modify config")
+	}
+	// Prepare 返回的函数调用之前不生效
+	apply, err := auth.Prepare(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsMaster("/game/gm/kick") {
+		t.Fatal("prepare should not apply rules")
+	}
+	apply()
+	if auth.IsMaster("/game/gm/kick") {
+		t.Fatal("apply should replace rules")
+	}
+}
+
+func TestRulesReport(t *testing.T) {
+	auth := &authorize{v: OAuthTypeOAuth}
+	auth.Set("game", "login", OAuthTypeNone)
+	auth.SetPermission("chat", "ban", "gm")
+	player := OAuthTypePlayer
+	if err := auth.Load([]*Rule{{Route: "/game/*", OAuth: &player}}); err != nil {
+		t.Fatal(err)
+	}
+	r := auth.Report([]string{"game"})
+	if len(r) != 3 || r[0] != "default oauth:1" {
+		t.Fatalf("report:%q", r)
+	}
+	// 配置规则优先,代码规则也要列出并显示最终生效的结果
+	if !strings.HasPrefix(r[1], "/game/* [config] oauth:3(config /game/*)") {
+		t.Fatalf("config rule:%s", r[1])
+	}
+	if !strings.HasPrefix(r[2], "/game/login [code] oauth:3(config /game/*)") {
+		t.Fatalf("code rule:%s", r[2])
+	}
+	// 不在服务列表中的规则不显示
+	for _, s := range r {
+		if strings.Contains(s, "/chat/") {
+			t.Fatalf("unexpected service:%s", s)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gwcfg
+
+import (
+	"sort"
+	"strings"
+)
+
+// RouteWildcard 路由中的单段通配符,如 /*/gm/query
+const RouteWildcard = "*"
+
+// trie 按路径分段匹配的路由树,匹配结果与注册顺序无关
+//
+//	精确匹配优先,其次最长前缀;深度相同时,从左到右第一个不同的段字面量优先于 *
+//	字符串前缀(insertString)最后一段按字符串前缀匹配,同一深度较长的优先,短于匹配到下一段的分段前缀
+type trie[T any] struct {
+	root *trieNode[T]
+	size int
+}
+
+type trieNode[T any] struct {
+	children map[string]*trieNode[T]
+	wildcard *trieNode[T]
+	exact    *trieLeaf[T]
+	prefix   *trieLeaf[T]            //匹配当前节点以及所有子路径
+	partial  map[string]*trieLeaf[T] //字符串前缀,下一段以 key 开头时匹配,包括所有子路径
+}
+
+type trieLeaf[T any] struct {
+	route string //规则,前缀规则以 /* 结尾,字符串前缀规则以 * 结尾
+	value T
+}
+
+// trieScore 匹配程度,依次比较深度,字符串前缀长度,是否精确匹配
+type trieScore struct {
+	depth   int
+	partial int
+	exact   bool
+}
+
+func (s trieScore) greater(o trieScore) bool {
+	if s.depth != o.depth {
+		return s.depth > o.depth
+	}
+	if s.partial != o.partial {
+		return s.partial > o.partial
+	}
+	return s.exact && !o.exact
+}
+
+func trieSplit(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// insert 添加规则,prefix 是否前缀匹配,重复时覆盖并返回 false
+func (t *trie[T]) insert(route string, prefix bool, v T) bool {
+	segs := trieSplit(route)
+	node := t.node(segs)
+	leaf := &trieLeaf[T]{route: "/" + strings.Join(segs, "/"), value: v}
+	p := &node.exact
+	if prefix {
+		p = &node.prefix
+		leaf.route = strings.TrimSuffix(leaf.route, "/") + RuleWildcard
+	}
+	ok := *p == nil
+	if ok {
+		t.size++
+	}
+	*p = leaf
+	return ok
+}
+
+// insertString 添加字符串前缀规则,如 /game/gm 匹配 /game/gm,/game/gmtool,/game/gm/query,重复时覆盖并返回 false
+func (t *trie[T]) insertString(route string, v T) bool {
+	segs := trieSplit(route)
+	if len(segs) == 0 || segs[len(segs)-1] == RouteWildcard {
+		return t.insert(route, true, v)
+	}
+	last := segs[len(segs)-1]
+	node := t.node(segs[:len(segs)-1])
+	if node.partial == nil {
+		node.partial = map[string]*trieLeaf[T]{}
+	}
+	_, exist := node.partial[last]
+	if !exist {
+		t.size++
+	}
+	node.partial[last] = &trieLeaf[T]{route: "/" + strings.Join(segs, "/") + RouteWildcard, value: v}
+	return !exist
+}
+
+// node 查找或者创建 segs 对应的节点
+func (t *trie[T]) node(segs []string) *trieNode[T] {
+	if t.root == nil {
+		t.root = &trieNode[T]{}
+	}
+	node := t.root
+	for _, s := range segs {
+		if s == RouteWildcard {
+			if node.wildcard == nil {
+				node.wildcard = &trieNode[T]{}
+			}
+			node = node.wildcard
+			continue
+		}
+		if node.children == nil {
+			node.children = map[string]*trieNode[T]{}
+		}
+		next := node.children[s]
+		if next == nil {
+			next = &trieNode[T]{}
+			node.children[s] = next
+		}
+		node = next
+	}
+	return node
+}
+
+// match 查找 path 匹配的规则,没有时返回 nil
+func (t *trie[T]) match(path string) *trieLeaf[T] {
+	if t.root == nil {
+		return nil
+	}
+	segs := trieSplit(path)
+	var best *trieLeaf[T]
+	var score trieScore //只有更高时才替换,先到先得保证字面量优先
+	set := func(leaf *trieLeaf[T], s trieScore) {
+		if best == nil || s.greater(score) {
+			best, score = leaf, s
+		}
+	}
+	var walk func(node *trieNode[T], i int)
+	walk = func(node *trieNode[T], i int) {
+		if node.prefix != nil {
+			set(node.prefix, trieScore{depth: i})
+		}
+		if i == len(segs) {
+			if node.exact != nil {
+				set(node.exact, trieScore{depth: i, exact: true})
+			}
+			return
+		}
+		for k, leaf := range node.partial {
+			if strings.HasPrefix(segs[i], k) {
+				set(leaf, trieScore{depth: i, partial: len(k)})
+			}
+		}
+		if next := node.children[segs[i]]; next != nil {
+			walk(next, i+1)
+		}
+		if node.wildcard != nil {
+			walk(node.wildcard, i+1)
+		}
+	}
+	walk(t.root, 0)
+	return best
+}
+
+// list 所有规则,按路由排序
+func (t *trie[T]) list() []*trieLeaf[T] {
+	r := make([]*trieLeaf[T], 0, t.size)
+	var walk func(node *trieNode[T])
+	walk = func(node *trieNode[T]) {
+		if node == nil {
+			return
+		}
+		if node.exact != nil {
+			r = append(r, node.exact)
+		}
+		if node.prefix != nil {
+			r = append(r, node.prefix)
+		}
+		for _, leaf := range node.partial {
+			r = append(r, leaf)
+		}
+		for _, next := range node.children {
+			walk(next)
+		}
+		walk(node.wildcard)
+	}
+	walk(t.root)
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].route < r[j].route
+	})
+	return r
+}
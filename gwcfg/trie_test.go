@@ -0,0 +1,163 @@
+package gwcfg
+
+import "testing"
+
+func TestTrieMatch(t *testing.T) {
+	tr := &trie[string]{}
+	rules := []struct {
+		route  string
+		prefix bool
+	}{
+		{"/game/gm", true},
+		{"/game/gm/query", false},
+		{"/game/gm/admin", true},
+		{"/*/login", false},
+		{"/game/*/rank", false},
+		{"/*/user/rank", false},
+		{"/game/user", true},
+		{"/", true},
+	}
+	for _, r := range rules {
+		tr.insert(r.route, r.prefix, r.route)
+	}
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/game/gm", "/game/gm/*"},
+		{"/game/gm/", "/game/gm/*"},
+		{"/game/gm/other", "/game/gm/*"},
+		{"/game/gmx", "/*"}, //按段匹配,不再按字符串前缀
+		{"/game/gm/query", "/game/gm/query"},
+		{"/game/gm/query/x", "/game/gm/*"},
+		{"/game/gm/admin/kick", "/game/gm/admin/*"},
+		{"/game/login", "/*/login"},
+		{"/chat/login", "/*/login"},
+		{"/game/user/rank", "/game/*/rank"}, //精确匹配优先于前缀,深度相同时左侧字面量优先于 *
+		{"/game/user/info", "/game/user/*"},
+		{"/game/hero/rank", "/game/*/rank"},
+		{"/other", "/*"},
+	}
+	for _, c := range cases {
+		leaf := tr.match(c.path)
+		if leaf == nil {
+			t.Fatalf("%s not matched", c.path)
+		}
+		if leaf.route != c.want {
+			t.Errorf("%s matched %s, want %s", c.path, leaf.route, c.want)
+		}
+	}
+}
+
+func TestTrieInsert(t *testing.T) {
+	tr := &trie[int]{}
+	if tr.match("/a") != nil {
+		t.Fatal("empty trie matched")
+	}
+	if !tr.insert("/a/b", false, 1) || !tr.insert("/a/b", true, 2) {
+		t.Fatal("exact and prefix rules are different")
+	}
+	if tr.insert("a/b/", false, 3) {
+		t.Fatal("duplicate rule should return false")
+	}
+	if v := tr.match("/a/b").value; v != 3 {
+		t.Fatalf("duplicate rule should replace, value:%d", v)
+	}
+	list := tr.list()
+	if len(list) != 2 || list[0].route != "/a/b" || list[1].route != "/a/b/*" {
+		t.Fatalf("list:%v", list)
+	}
+}
+
+func TestTrieString(t *testing.T) {
+	tr := &trie[string]{}
+	tr.insertString("/game/g", "g")
+	tr.insertString("/game/gm", "gm")
+	tr.insert("/game/gm/admin", true, "admin")
+	tr.insert("/game/gmtool/query", false, "query")
+	tr.insertString("/*/gm", "*gm")
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/game/gm", "gm"},
+		{"/game/gmtool", "gm"}, //最长字符串前缀优先
+		{"/game/gm/query", "gm"},
+		{"/game/gold", "g"},
+		{"/game/gm/admin/kick", "admin"}, //分段前缀更深
+		{"/game/gmtool/query", "query"},
+		{"/chat/gmx", "*gm"},
+	}
+	for _, c := range cases {
+		leaf := tr.match(c.path)
+		if leaf == nil {
+			t.Fatalf("%s not matched", c.path)
+		}
+		if leaf.value != c.want {
+			t.Errorf("%s matched %s, want %s", c.path, leaf.value, c.want)
+		}
+	}
+	if tr.match("/chat/g") != nil {
+		t.Fatal("/chat/g should not match")
+	}
+	if tr.insertString("game/gm/", "x") {
+		t.Fatal("duplicate rule should return false")
+	}
+	if leaf := tr.match("/game/gm"); leaf.route != "/game/gm*" || leaf.value != "x" {
+		t.Fatalf("duplicate rule should replace:%v", leaf)
+	}
+}
+
+// 旧版本按字符串前缀匹配的规则保持不变,按段匹配需要使用 XxxSegment
+func TestAuthorizePrefix(t *testing.T) {
+	auth := &authorize{v: OAuthTypePlayer}
+	auth.SetMaster("game", "gm")
+	auth.SetMasterSegment("chat", "gm")
+	auth.Prefix("game", "open", OAuthTypeNone)
+	auth.PrefixSegment("chat", "open", OAuthTypeNone)
+	auth.PrefixPermission("game", "gm", "gm")
+	auth.PrefixPermission("game", "gmtool", "gm.tool")
+	auth.PrefixPermissionSegment("chat", "gm", "gm")
+	if !auth.IsMaster("/game/gmtool") || !auth.IsMaster("/game/gm/query") {
+		t.Fatal("SetMaster should match by string prefix")
+	}
+	if auth.IsMaster("/chat/gmtool") || !auth.IsMaster("/chat/gm/query") {
+		t.Fatal("SetMasterSegment should match by segment")
+	}
+	if v, _ := auth.Get("game/openid"); v != OAuthTypeNone {
+		t.Fatalf("Prefix should match by string prefix:%d", v)
+	}
+	if v, _ := auth.Get("chat/openid"); v != OAuthTypePlayer {
+		t.Fatalf("PrefixSegment should match by segment:%d", v)
+	}
+	if p := auth.GetPermission("/game/gmtool/kick"); p != "gm.tool" {
+		t.Fatalf("longest prefix permission:%s", p)
+	}
+	if p := auth.GetPermission("/game/gmx"); p != "gm" {
+		t.Fatalf("prefix permission:%s", p)
+	}
+	if p := auth.GetPermission("/chat/gmx"); p != "" {
+		t.Fatalf("segment permission:%s", p)
+	}
+}
+
+func TestProtocolAllow(t *testing.T) {
+	cases := []struct {
+		allow protocol
+		t     int8
+		want  bool
+	}{
+		{0, ProtocolTypeKCP, true},
+		{protocol(ProtocolTypeHTTP), ProtocolTypeHTTP, true},
+		{protocol(ProtocolTypeHTTP), ProtocolTypeTCP, false},
+		{protocol(ProtocolTypeTCP), ProtocolTypeKCP, true},
+		{protocol(ProtocolTypeWSS | ProtocolTypeHTTP), ProtocolTypeKCP, false},
+		{protocol(ProtocolTypeKCP), ProtocolTypeKCP, true},
+		{protocol(ProtocolTypeKCP), ProtocolTypeTCP, false},
+	}
+	for _, c := range cases {
+		if got := c.allow.Allow(c.t); got != c.want {
+			t.Fatalf("protocol %d allow %d:%v want:%v", c.allow, c.t, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"encoding/json"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+	"github.com/hwcer/logger"
+)
+
+// Kick 踢下线,长连接推送 S2CDisconnect 后断开,删除在线信息并使 TOKEN 失效,
+// gwcfg.Options.Kick 秒内禁止使用旧的重连秘钥恢复会话
+// 参数:
+//   - p: 玩家会话
+//   - reason: 断开原因,一般为 errors 中的错误码
+//
+// 返回值:
+//   - bool: 是否在线
+func Kick(p *session.Data, reason error) bool {
+	return kickPlayer(p, reason, gwcfg.Options.Kick)
+}
+
+func kickPlayer(p *session.Data, reason error, block int64) bool {
+	if p == nil || players.Get(p.UUID()) == nil {
+		return false
+	}
+	if sock := players.Socket(p); sock != nil {
+		TCP.S2CDisconnect(sock, reason)
+	}
+	players.Block(p.UUID(), block)
+	players.Delete(p)
+	if err := session.New(p).Delete(); err != nil {
+		logger.Debug("踢下线删除会话失败,GUID:%s err:%v", p.UUID(), err)
+	}
+	logger.Debug("玩家被踢下线,GUID:%s 原因:%v", p.UUID(), reason)
+	return true
+}
+
+// kick 游戏服踢下线,返回是否在线
+// metadata: guid 或 uid,_kick_code 原因(错误码),_kick_block 禁止断线重连的时间(秒)
+// body: 可选,随 S2CDisconnect 推送给客户端的内容
+func kick(c *cosrpc.Context) any {
+	online, err := KickPlayer(values.Metadata(c.Metadata()), c.Bytes())
+	if err != nil {
+		return err
+	}
+	return online
+}
+
+// KickPlayer 按 GUID/UID 踢下线,进程内调用,参数与 RPC kick 接口相同
+func KickPlayer(mate values.Metadata, body []byte) (bool, error) {
+	guid := mate.Get(gwcfg.ServiceMetadataGUID)
+	uid := mate.Get(gwcfg.ServiceMetadataUID)
+	if guid == "" && uid == "" {
+		return false, values.Error("guid and uid empty")
+	}
+	reason := &values.Message{Code: errors.ErrKicked.Code}
+	if _, ok := mate[gwcfg.ServiceKickCode]; ok {
+		reason.Code = mate.GetInt32(gwcfg.ServiceKickCode)
+	}
+	if len(body) > 0 {
+		if json.Valid(body) {
+			reason.Data = json.RawMessage(body)
+		} else {
+			reason.Data = string(body)
+		}
+	}
+	block := gwcfg.Options.Kick
+	if _, ok := mate[gwcfg.ServiceKickBlock]; ok {
+		block = mate.GetInt64(gwcfg.ServiceKickBlock)
+	}
+	return kickPlayer(players.Find(guid, uid), reason, block), nil
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// 接口限流,令牌桶保存在当前网关内存中,多个网关分别计数
+
+var Limiter = newLimiter()
+
+// LimiterSweep 清理空闲令牌桶的间隔
+var LimiterSweep = time.Minute
+
+const limiterShards = 64
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time //令牌恢复满的时间,之后可以清理
+}
+
+type limiterShard struct {
+	dict   map[string]*bucket
+	sweep  time.Time
+	locker sync.Mutex
+}
+
+type limiter struct {
+	shards [limiterShards]*limiterShard
+}
+
+func newLimiter() *limiter {
+	r := &limiter{}
+	for i := range r.shards {
+		r.shards[i] = &limiterShard{dict: map[string]*bucket{}, sweep: time.Now()}
+	}
+	return r
+}
+
+// Verify 检查接口调用频率,path 为 /servicePath/serviceMethod,超出时返回 errors.ErrTooManyRequests
+func (this *limiter) Verify(proxy Proxy, p *session.Data, path string) error {
+	ls := gwcfg.Limits.Match(path)
+	if len(ls) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, l := range ls {
+		id := this.Id(proxy, p, l.Key)
+		if id == "" {
+			continue
+		}
+		if !this.Allow(l, id, now) {
+			logger.Debug("接口限流,PATH:%s KEY:%s ID:%s", path, l.Key, id)
+			return errors.ErrTooManyRequests
+		}
+	}
+	return nil
+}
+
+// Id 计数对象,guid,uid 不存在时依次降级为账号,IP
+func (this *limiter) Id(proxy Proxy, p *session.Data, key string) string {
+	if p != nil {
+		switch key {
+		case gwcfg.LimitKeyUID:
+			if uid := p.GetString(gwcfg.ServiceMetadataUID); uid != "" {
+				return gwcfg.LimitKeyUID + ":" + uid
+			}
+			fallthrough
+		case gwcfg.LimitKeyGUID:
+			if guid := p.UUID(); guid != "" {
+				return gwcfg.LimitKeyGUID + ":" + guid
+			}
+		}
+	}
+	if ip := proxy.RemoteAddr(); ip != "" {
+		return gwcfg.LimitKeyIP + ":" + ip
+	}
+	return ""
+}
+
+// Allow 消耗一个令牌,id 为计数对象
+func (this *limiter) Allow(l *gwcfg.Limit, id string, now time.Time) bool {
+	k := l.Key + "|" + l.Route + "|" + id
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(k))
+	shard := this.shards[h.Sum32()%limiterShards]
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
+	capacity := l.Capacity()
+	if now.Sub(shard.sweep) >= LimiterSweep {
+		shard.sweep = now
+		for s, b := range shard.dict {
+			if now.After(b.full) {
+				delete(shard.dict, s)
+			}
+		}
+	}
+	b := shard.dict[k]
+	if b == nil {
+		b = &bucket{tokens: capacity, last: now}
+		shard.dict[k] = b
+	} else if d := now.Sub(b.last); d > 0 {
+		b.tokens += d.Seconds() * l.Rate
+		b.last = now
+	}
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((capacity - b.tokens) / l.Rate * float64(time.Second)))
+	return true
+}
+
+// Len 当前令牌桶数量
+func (this *limiter) Len() (n int) {
+	for _, shard := range this.shards {
+		shard.locker.Lock()
+		n += len(shard.dict)
+		shard.locker.Unlock()
+	}
+	return
+}
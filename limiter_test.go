@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	l := newLimiter()
+	rule := &gwcfg.Limit{Route: "/game/mail/*", Key: gwcfg.LimitKeyIP, Rate: 2, Burst: 3}
+	now := time.Now()
+	// 初始满桶,可以瞬间消耗 Burst 个令牌
+	for i := 0; i < 3; i++ {
+		if !l.Allow(rule, "ip:1.1.1.1", now) {
+			t.Fatalf("burst %d should be allowed", i)
+		}
+	}
+	if l.Allow(rule, "ip:1.1.1.1", now) {
+		t.Fatal("empty bucket should be denied")
+	}
+	// 不同对象分别计数
+	if !l.Allow(rule, "ip:2.2.2.2", now) {
+		t.Fatal("other id should be allowed")
+	}
+	// 按 Rate 恢复,0.5秒恢复1个
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow(rule, "ip:1.1.1.1", now) {
+		t.Fatal("refilled token should be allowed")
+	}
+	if l.Allow(rule, "ip:1.1.1.1", now) {
+		t.Fatal("only one token refilled")
+	}
+	// 长时间空闲不超过容量
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !l.Allow(rule, "ip:1.1.1.1", now) {
+			t.Fatalf("refilled burst %d should be allowed", i)
+		}
+	}
+	if l.Allow(rule, "ip:1.1.1.1", now) {
+		t.Fatal("tokens should not exceed capacity")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := newLimiter()
+	rule := &gwcfg.Limit{Route: "/game/*", Key: gwcfg.LimitKeyIP, Rate: 10}
+	shard := func(id string) uint32 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(rule.Key + "|" + rule.Route + "|" + id))
+		return h.Sum32() % limiterShards
+	}
+	// 找到与 ip:0 在同一个分片的另一个对象
+	other := ""
+	for i := 1; other == ""; i++ {
+		if id := "ip:" + strconv.Itoa(i); shard(id) == shard("ip:0") {
+			other = id
+		}
+	}
+	now := time.Now()
+	l.Allow(rule, "ip:0", now)
+	if n := l.Len(); n != 1 {
+		t.Fatalf("buckets:%d", n)
+	}
+	// 未到清理间隔时保留
+	l.Allow(rule, other, now.Add(time.Second))
+	if n := l.Len(); n != 2 {
+		t.Fatalf("buckets before sweep:%d", n)
+	}
+	// 令牌恢复满并超过清理间隔后删除
+	l.Allow(rule, other, now.Add(LimiterSweep+time.Second))
+	if n := l.Len(); n != 1 {
+		t.Fatalf("buckets after sweep:%d", n)
+	}
+}
@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+	"github.com/hwcer/logger"
+)
+
+// MaintenanceInterval 检查维护计划的间隔
+var MaintenanceInterval = time.Second
+
+// MaintenanceReset 调用 RPC maintenance 时 metadata 中设置此项,恢复使用配置文件
+const MaintenanceReset = "reset"
+
+// MaintenanceStatus RPC maintenance 返回的当前维护设置
+type MaintenanceStatus struct {
+	Maintain *gwcfg.Maintenance `json:"maintain"`
+	Runtime  bool               `json:"runtime"` //是否通过 RPC 设置
+	Active   bool               `json:"active"`  //当前是否处于维护中
+}
+
+var maintainer = &maintainScheduler{}
+
+// maintainScheduler 执行维护计划: 开始前推送公告,开始时断开白名单以外的玩家
+type maintainScheduler struct {
+	active   bool
+	notified int64 //已经推送过公告的计划开始时间
+	locker   sync.Mutex
+}
+
+func (this *maintainScheduler) start() {
+	background.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(MaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				this.check(time.Now().Unix())
+			}
+		}
+	})
+}
+
+func (this *maintainScheduler) check(now int64) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	m, _ := gwcfg.Maintain.Get()
+	if m == nil {
+		return
+	}
+	if m.Notify > 0 && m.Start > now && m.Start-m.Notify <= now && this.notified != m.Start {
+		this.notified = m.Start
+		this.notify(m)
+	}
+	active := m.Active(now)
+	if active && !this.active {
+		logger.Alert("网关进入维护模式,公告:%s", m.Notice)
+		if m.Kick {
+			this.kick()
+		}
+	} else if !active && this.active {
+		logger.Alert("网关维护结束")
+	}
+	this.active = active
+}
+
+// notify 给所有在线玩家推送维护公告
+func (this *maintainScheduler) notify(m *gwcfg.Maintenance) {
+	if Setting.S2CMaintenance == "" {
+		return
+	}
+	body, err := json.Marshal(m.Payload())
+	if err != nil {
+		logger.Alert("维护公告序列化失败:%v", err)
+		return
+	}
+	if err = Broadcast(values.Metadata{gwcfg.ServiceMessagePath: Setting.S2CMaintenance}, body); err != nil {
+		logger.Alert("维护公告推送失败:%v", err)
+	}
+}
+
+// kick 断开开发者和白名单以外的玩家
+func (this *maintainScheduler) kick() {
+	reason := gwcfg.Maintain.Error()
+	var n int
+	players.Range(func(p *session.Data) bool {
+		if Access.IsDeveloper(p) {
+			return true
+		}
+		sock := players.Socket(p)
+		var ip string
+		if sock != nil {
+			ip = SocketIP(sock)
+		}
+		if gwcfg.Maintain.Allow(p.UUID(), ip) {
+			return true
+		}
+		if Kick(p, reason) {
+			n++
+		}
+		return true
+	})
+	logger.Alert("维护开始,断开玩家数量:%d", n)
+}
+
+// maintenance 查看或者修改维护模式
+// body 为 gwcfg.Maintenance JSON 时修改,为空时只返回当前设置; metadata 中有 reset 时恢复使用配置文件
+func maintenance(c *cosrpc.Context) any {
+	r, err := SetMaintenance(values.Metadata(c.Metadata()), c.Bytes())
+	if err != nil {
+		return err
+	}
+	return r
+}
+
+// SetMaintenance 查看或者修改维护模式,进程内调用,参数与 RPC maintenance 接口相同
+// 修改后立即检查维护计划,需要时推送公告和断开玩家
+func SetMaintenance(mate values.Metadata, body []byte) (*MaintenanceStatus, error) {
+	if mate.Get(MaintenanceReset) != "" {
+		if err := gwcfg.Maintain.Set(nil); err != nil {
+			return nil, err
+		}
+		logger.Alert("维护模式恢复使用配置文件")
+	} else if len(body) > 0 {
+		m := &gwcfg.Maintenance{}
+		if err := json.Unmarshal(body, m); err != nil {
+			return nil, err
+		}
+		if err := gwcfg.Maintain.Set(m); err != nil {
+			return nil, err
+		}
+		logger.Alert("维护模式修改:%s", body)
+	}
+	maintainer.check(time.Now().Unix())
+	m, runtime := gwcfg.Maintain.Get()
+	return &MaintenanceStatus{Maintain: m, Runtime: runtime, Active: gwcfg.Maintain.Active()}, nil
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+// 维护计划开始前只推送一次公告,开始和结束时切换状态
+func TestMaintainerNotify(t *testing.T) {
+	path, response := Setting.S2CMaintenance, Setting.Response
+	t.Cleanup(func() {
+		Setting.S2CMaintenance, Setting.Response = path, response
+		_ = gwcfg.Maintain.Set(nil)
+		maintainer.active, maintainer.notified = false, 0
+	})
+	var notices []string
+	Setting.Response = func(c *Context, reply []byte) ([]byte, error) {
+		notices = append(notices, c.Path()+" "+string(reply))
+		return reply, nil
+	}
+	if err := gwcfg.Maintain.Set(&gwcfg.Maintenance{Start: 1000, End: 2000, Notice: "update", Notify: 100}); err != nil {
+		t.Fatal(err)
+	}
+	maintainer.check(800)
+	if len(notices) != 0 {
+		t.Fatal("notice pushed before notify time")
+	}
+	Setting.S2CMaintenance = ""
+	maintainer.check(900)
+	if len(notices) != 0 {
+		t.Fatal("notice pushed without Setting.S2CMaintenance")
+	}
+	Setting.S2CMaintenance = "S2CMaintenance"
+	maintainer.notified = 0
+	maintainer.check(900)
+	maintainer.check(950)
+	want := `S2CMaintenance {"notice":"update","start":1000,"end":2000}`
+	if len(notices) != 1 || notices[0] != want {
+		t.Fatalf("notices:%q", notices)
+	}
+	maintainer.check(1000)
+	if !maintainer.active {
+		t.Fatal("maintenance should start")
+	}
+	maintainer.check(2000)
+	if maintainer.active {
+		t.Fatal("maintenance should end")
+	}
+}
+
+func TestSetMaintenance(t *testing.T) {
+	t.Cleanup(func() {
+		_ = gwcfg.Maintain.Set(nil)
+		maintainer.active, maintainer.notified = false, 0
+	})
+	now := time.Now().Unix()
+	body := fmt.Sprintf(`{"start":%d,"notice":"update","guid":["tester"]}`, now-1)
+	r, err := SetMaintenance(nil, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Runtime || !r.Active || r.Maintain.Notice != "update" || !maintainer.active {
+		t.Fatalf("status:%+v", r)
+	}
+	if _, err = SetMaintenance(nil, []byte(`{"start":10,"end":5}`)); err == nil {
+		t.Fatal("end before start should fail")
+	}
+	// body 为空时只返回当前设置
+	if r, err = SetMaintenance(nil, nil); err != nil || r.Maintain.Notice != "update" {
+		t.Fatalf("status:%+v err:%v", r, err)
+	}
+	if r, err = SetMaintenance(values.Metadata{MaintenanceReset: "1"}, nil); err != nil || r.Runtime {
+		t.Fatalf("reset status:%+v err:%v", r, err)
+	}
+}
@@ -9,12 +9,14 @@ import (
 	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosrpc/redis"
 	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/token"
 
 	"github.com/hwcer/cosgo"
 	"github.com/hwcer/cosgo/scc"
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosnet"
 	"github.com/hwcer/coswss"
+	"github.com/hwcer/logger"
 	"github.com/soheilhy/cmux"
 )
 
@@ -52,14 +54,13 @@ func (this *Module) Init() (err error) {
 	if err != nil {
 		return err
 	}
-
 	if i := strings.Index(gwcfg.Options.Gate.Address, ":"); i < 0 {
 		return errors.New("网关地址配置错误,格式: ip:port")
 	} else if gwcfg.Options.Gate.Address[0:i] == "" {
 		gwcfg.Options.Gate.Address = "0.0.0.0" + gwcfg.Options.Gate.Address
 	}
 	p := gwcfg.Options.Gate.Protocol
-	if p.Has(gwcfg.ProtocolTypeTCP) || p.Has(gwcfg.ProtocolTypeWSS) {
+	if p.Has(gwcfg.ProtocolTypeTCP) || p.Has(gwcfg.ProtocolTypeWSS) || p.Has(gwcfg.ProtocolTypeKCP) {
 		if err = TCP.init(); err != nil {
 			return err
 		}
@@ -77,6 +78,9 @@ func (this *Module) Init() (err error) {
 		}
 		gwcfg.Authorize.Set(ServicePath, ServiceMethod, gwcfg.OAuthTypeOAuth)
 	}
+	for _, s := range gwcfg.Authorize.Report(Setting.Services()) {
+		logger.Trace("接口权限 %s", s)
+	}
 
 	return nil
 }
@@ -85,11 +89,15 @@ func (this *Module) Start() (err error) {
 	if err = redis.Start(); err != nil {
 		return
 	}
+	Broadcaster.start()
+	Outbound.start()
+	maintainer.start()
 	if gwcfg.Options.Gate.Protocol.CMux() {
 		var ln net.Listener
 		if ln, err = net.Listen("tcp", gwcfg.Options.Gate.Address); err != nil {
 			return err
 		}
+		Drain.listen(ln)
 		this.mux = cmux.New(ln)
 	}
 	p := gwcfg.Options.Gate.Protocol
@@ -105,6 +113,16 @@ func (this *Module) Start() (err error) {
 			return err
 		}
 	}
+	//KCP
+	if p.Has(gwcfg.ProtocolTypeKCP) {
+		address := gwcfg.Options.Gate.Address
+		if c := gwcfg.Options.Gate.KCP; c != nil && c.Address != "" {
+			address = c.Address
+		}
+		if err = TCP.ListenKCP(address); err != nil {
+			return err
+		}
+	}
 	//http
 	if p.Has(gwcfg.ProtocolTypeHTTP) {
 		if this.mux != nil {
@@ -123,8 +141,12 @@ func (this *Module) Start() (err error) {
 		if p.Has(gwcfg.ProtocolTypeHTTP) {
 			err = HTTP.wss() //在COSWEB上启动WS
 		} else {
-			// 使用coswss.New创建WebSocket服务器
-			err = coswss.New(TCP.Sockets, gwcfg.Options.Gate.Address, gwcfg.Options.Gate.Websocket)
+			// 使用coswss.Accept创建WebSocket服务器,监听器由 Drain 关闭
+			var ln net.Listener
+			if ln, err = net.Listen("tcp", gwcfg.Options.Gate.Address); err == nil {
+				Drain.listen(ln)
+				err = coswss.Accept(TCP.Sockets, ln, gwcfg.Options.Gate.Websocket)
+			}
 		}
 		if err != nil {
 			return err
@@ -140,20 +162,42 @@ func (this *Module) Start() (err error) {
 	return err
 }
 
+// Reload 在配置副本上解析并检查所有配置,全部通过后再替换,失败时保留原配置
 func (this *Module) Reload() error {
-
-	if err := cosgo.Config.Unmarshal(&gwcfg.Options); err != nil {
+	opts, err := gwcfg.Options.Clone()
+	if err != nil {
+		return err
+	}
+	if err = cosgo.Config.Unmarshal(opts); err != nil {
 		return err
 	}
-	if gwcfg.Options.Appid == "" {
-		gwcfg.Options.Appid = cosgo.Name()
+	if opts.Appid == "" {
+		opts.Appid = cosgo.Name()
+	}
+	//防重放可能连接 redis,放在最后检查
+	var applies []func()
+	for _, prepare := range []func() (func(), error){
+		func() (func(), error) { return gwcfg.Authorize.Prepare(opts.Rules) },
+		func() (func(), error) { return gwcfg.Limits.Prepare(opts.Limits) },
+		func() (func(), error) { return gwcfg.IPFilter.Prepare(opts.ACL) },
+		func() (func(), error) { return gwcfg.Maintain.Prepare(opts.Maintain, opts.Maintenance) },
+		func() (func(), error) { return token.Prepare(opts) },
+	} {
+		apply, err := prepare()
+		if err != nil {
+			return err
+		}
+		applies = append(applies, apply)
+	}
+	gwcfg.Options = *opts
+	for _, apply := range applies {
+		apply()
 	}
-
 	return nil
 }
+
+// Close 关闭所有监听器后立即返回,平滑关闭在后台执行,需要等待时使用 Drain.Shutdown 返回的 channel
 func (this *Module) Close() (err error) {
-	if this.mux != nil {
-		this.mux.Close()
-	}
+	Drain.Shutdown()
 	return nil
 }
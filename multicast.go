@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosnet/message"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/gateway/players"
+)
+
+// MulticastArgs 玩家列表较多时通过 body 传递,此时 metadata 中不能有 _msg_guid 和 _msg_uid
+type MulticastArgs struct {
+	Guid []string `json:"guid"`
+	Uid  []string `json:"uid"`
+	Body []byte   `json:"body"` //推送内容,JSON 中为 base64
+}
+
+// MulticastResult multicast 推送结果
+type MulticastResult struct {
+	Delivered int `json:"delivered"` //已经推送
+	Offline   int `json:"offline"`   //不在线或者长连接已断开
+}
+
+// multicast 按 GUID/UID 列表推送
+func multicast(c *cosrpc.Context) any {
+	r, err := Multicast(values.Metadata(c.Metadata()), c.Bytes())
+	if err != nil {
+		return err
+	}
+	return r
+}
+
+// Multicast 按 GUID/UID 列表推送,进程内调用,参数与 RPC multicast 接口相同
+// metadata 中 _msg_guid,_msg_uid 为逗号分隔的列表,都为空时 body 为 MulticastArgs JSON
+// Setting.Response 只执行一次,与广播相同 Context 中没有 Session
+func Multicast(mate values.Metadata, body []byte) (r *MulticastResult, err error) {
+	args := &MulticastArgs{Body: body}
+	if s := mate.Get(gwcfg.ServiceMessageGUID); s != "" {
+		args.Guid = strings.Split(s, ",")
+	}
+	if s := mate.Get(gwcfg.ServiceMessageUID); s != "" {
+		args.Uid = strings.Split(s, ",")
+	}
+	if len(args.Guid) == 0 && len(args.Uid) == 0 {
+		args.Body = nil
+		if err = json.Unmarshal(body, args); err != nil {
+			return nil, err
+		}
+	}
+	path := mate.Get(gwcfg.ServiceMessagePath)
+	if path == "" {
+		return nil, values.Error("path empty")
+	}
+	flag := message.Flag(mate.GetInt32(gwcfg.ServiceResponseFlag))
+	body = args.Body
+	if Setting.Response != nil {
+		ctx := NewContextWithSocket(path, &flag, mate, nil)
+		if body, err = Setting.Response(ctx, body); err != nil {
+			return nil, err
+		}
+	}
+
+	m := newOutboundMessage(flag, 0, path, body, mate)
+	_, buffer := mate[gwcfg.ServiceMessageBuffer]
+	r = &MulticastResult{}
+	push := func(p *session.Data) {
+		if pushPlayer(p, players.Socket(p), m) {
+			r.Delivered++
+			return
+		}
+		if buffer && !Stream.Reliable(p) {
+			Pending.Push(p, m)
+		}
+		r.Offline++
+	}
+	done := make(map[string]struct{}, len(args.Guid))
+	for _, guid := range args.Guid {
+		if _, ok := done[guid]; ok || guid == "" {
+			continue
+		}
+		done[guid] = struct{}{}
+		if p := players.Get(guid); p != nil {
+			push(p)
+		} else {
+			r.Offline++
+		}
+	}
+	if len(args.Uid) == 0 {
+		return r, nil
+	}
+	// 只有 UID 时需要遍历所有玩家
+	uid := make(map[string]bool, len(args.Uid))
+	for _, v := range args.Uid {
+		if v != "" {
+			uid[v] = false
+		}
+	}
+	players.Range(func(p *session.Data) bool {
+		k := p.GetString(gwcfg.ServiceMetadataUID)
+		if found, ok := uid[k]; !ok || found {
+			return true
+		}
+		uid[k] = true
+		if _, ok := done[p.UUID()]; !ok {
+			done[p.UUID()] = struct{}{}
+			push(p)
+		}
+		return true
+	})
+	for _, found := range uid {
+		if !found {
+			r.Offline++
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,269 @@
+package gateway
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/cosnet/message"
+	"github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// 长连接推送积压控制,配置 gwcfg.Options.Outbound
+// 推送不阻塞,sock.Send 失败(发送缓冲已满)的推送进入连接的待发送队列,由后台按顺序重试,
+// 队列超出限制时按策略合并相同 key 的推送,丢弃低优先级推送,仍然超出时断开连接
+
+var Outbound = &outbound{}
+
+// OutboundTop 统计中按积压数量列出的连接数量
+var OutboundTop = 20
+
+type outboundMessage struct {
+	flag   message.Flag
+	rid    int32
+	path   string
+	body   []byte
+	low    bool   //低优先级,积压时优先丢弃
+	key    string //合并 key,积压时只保留最新的一条
+	buffer bool   //_msg_buffer,连接断开时转入 Pending
+}
+
+// newOutboundMessage 推送消息,metadata 中 _msg_low 标记低优先级,_msg_conflate 设置合并 key(为空时使用 path)
+func newOutboundMessage(flag message.Flag, rid int32, path string, body []byte, mate values.Metadata) *outboundMessage {
+	m := &outboundMessage{flag: flag, rid: rid, path: path, body: body}
+	if mate != nil {
+		_, m.low = mate[gwcfg.ServiceMessageLow]
+		_, m.buffer = mate[gwcfg.ServiceMessageBuffer]
+		if k, ok := mate[gwcfg.ServiceMessageConflate]; ok {
+			if m.key = k; m.key == "" {
+				m.key = path
+			}
+		}
+	}
+	return m
+}
+
+// send 不阻塞,发送缓冲已满时返回错误,由调用者放入待发送队列
+func (m *outboundMessage) send(sock *cosnet.Socket) error {
+	return sock.Send(m.flag, m.rid, m.path, m.body, false)
+}
+
+// outbox 单个连接的待发送队列
+type outbox struct {
+	sock   *cosnet.Socket
+	queue  []*outboundMessage
+	bytes  int
+	locker sync.Mutex
+}
+
+// OutboundSocket 单个连接的积压
+type OutboundSocket struct {
+	Socket   uint64 `json:"socket"`
+	Guid     string `json:"guid,omitempty"`
+	Messages int    `json:"messages"`
+	Bytes    int    `json:"bytes"`
+}
+
+// OutboundStats 推送积压统计
+type OutboundStats struct {
+	Sockets   int               `json:"sockets"`   //有积压的连接数
+	Messages  int               `json:"messages"`  //积压的推送数量
+	Bytes     int               `json:"bytes"`     //积压的推送字节数
+	Dropped   uint64            `json:"dropped"`   //丢弃的低优先级推送
+	Conflated uint64            `json:"conflated"` //被合并的推送
+	Kicked    uint64            `json:"kicked"`    //积压超出限制断开的连接
+	Top       []*OutboundSocket `json:"top"`       //积压最多的连接
+	Options   gwcfg.Outbound    `json:"options"`
+}
+
+type outbound struct {
+	dict      sync.Map //socket id => *outbox
+	dropped   atomic.Uint64
+	conflated atomic.Uint64
+	kicked    atomic.Uint64
+}
+
+func (this *outbound) options() gwcfg.Outbound {
+	if c := gwcfg.Options.Outbound; c != nil {
+		return *c
+	}
+	return gwcfg.Outbound{}
+}
+
+func (this *outbound) start() {
+	interval := time.Duration(this.options().Interval) * time.Millisecond
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	background.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				this.flush()
+			}
+		}
+	})
+}
+
+// Send 推送消息,发送缓冲已满时进入待发送队列,积压超出限制断开连接时返回 errors.ErrSlowConsumer
+func (this *outbound) Send(sock *cosnet.Socket, m *outboundMessage) error {
+	if v, ok := this.dict.Load(sock.Id()); ok {
+		return this.push(v.(*outbox), m)
+	}
+	if err := m.send(sock); err == nil {
+		return nil
+	} else if !sock.IsReady() {
+		return err //连接已经断开或正在关闭,不进入待发送队列
+	}
+	v, _ := this.dict.LoadOrStore(sock.Id(), &outbox{sock: sock})
+	return this.push(v.(*outbox), m)
+}
+
+func (this *outbound) push(box *outbox, m *outboundMessage) error {
+	box.locker.Lock()
+	if len(box.queue) == 0 && m.send(box.sock) == nil {
+		box.locker.Unlock()
+		return nil
+	}
+	box.queue = append(box.queue, m)
+	box.bytes += len(m.body)
+	ok := this.limit(box)
+	box.locker.Unlock()
+	if ok {
+		return nil
+	}
+	this.kicked.Add(1)
+	logger.Debug("推送积压超出限制,Socket:%d IP:%s", box.sock.Id(), SocketIP(box.sock))
+	this.dict.Delete(box.sock.Id())
+	TCP.Kick(box.sock, errors.ErrSlowConsumer)
+	return errors.ErrSlowConsumer
+}
+
+// limit 积压超出限制时按策略处理,需要加锁,返回 false 时需要断开连接
+func (this *outbound) limit(box *outbox) bool {
+	opts := this.options()
+	over := func() bool {
+		return (opts.Messages > 0 && len(box.queue) > opts.Messages) || (opts.Bytes > 0 && box.bytes > opts.Bytes)
+	}
+	if !over() {
+		return true
+	}
+	if opts.Policy == gwcfg.OutboundPolicyDisconnect {
+		return false
+	}
+	if opts.Policy == gwcfg.OutboundPolicyConflate {
+		if m := box.queue[len(box.queue)-1]; m.key != "" {
+			for i, v := range box.queue[:len(box.queue)-1] {
+				if v.key == m.key {
+					box.remove(i)
+					this.conflated.Add(1)
+					break
+				}
+			}
+		}
+	}
+	for i := 0; i < len(box.queue) && over(); {
+		if box.queue[i].low {
+			box.remove(i)
+			this.dropped.Add(1)
+		} else {
+			i++
+		}
+	}
+	return !over()
+}
+
+func (box *outbox) remove(i int) {
+	box.bytes -= len(box.queue[i].body)
+	box.queue = append(box.queue[:i], box.queue[i+1:]...)
+}
+
+// flush 按顺序重试所有待发送队列
+func (this *outbound) flush() {
+	this.dict.Range(func(k, v any) bool {
+		box := v.(*outbox)
+		box.locker.Lock()
+		defer box.locker.Unlock()
+		for len(box.queue) > 0 {
+			m := box.queue[0]
+			if m.send(box.sock) != nil {
+				break
+			}
+			box.remove(0)
+		}
+		return true
+	})
+}
+
+// Remove 连接断开,删除并返回待发送队列中带 _msg_buffer 的推送,其他推送丢弃
+func (this *outbound) Remove(sock *cosnet.Socket) (r []*outboundMessage) {
+	v, ok := this.dict.LoadAndDelete(sock.Id())
+	if !ok {
+		return
+	}
+	box := v.(*outbox)
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	for _, m := range box.queue {
+		if m.buffer {
+			r = append(r, m)
+		}
+	}
+	box.queue = nil
+	box.bytes = 0
+	return
+}
+
+// Len 连接积压的推送数量和字节数
+func (this *outbound) Len(sock *cosnet.Socket) (messages int, bytes int) {
+	v, ok := this.dict.Load(sock.Id())
+	if !ok {
+		return
+	}
+	box := v.(*outbox)
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	return len(box.queue), box.bytes
+}
+
+// Stats 推送积压统计
+func (this *outbound) Stats() *OutboundStats {
+	r := &OutboundStats{Dropped: this.dropped.Load(), Conflated: this.conflated.Load(), Kicked: this.kicked.Load(), Options: this.options()}
+	this.dict.Range(func(k, v any) bool {
+		box := v.(*outbox)
+		box.locker.Lock()
+		s := &OutboundSocket{Socket: box.sock.Id(), Messages: len(box.queue), Bytes: box.bytes}
+		box.locker.Unlock()
+		if s.Messages == 0 {
+			return true
+		}
+		if p := box.sock.Data(); p != nil {
+			s.Guid = p.UUID()
+		}
+		r.Sockets++
+		r.Messages += s.Messages
+		r.Bytes += s.Bytes
+		r.Top = append(r.Top, s)
+		return true
+	})
+	sort.Slice(r.Top, func(i, j int) bool {
+		if r.Top[i].Messages != r.Top[j].Messages {
+			return r.Top[i].Messages > r.Top[j].Messages
+		}
+		return r.Top[i].Socket < r.Top[j].Socket
+	})
+	if len(r.Top) > OutboundTop {
+		r.Top = r.Top[:OutboundTop]
+	}
+	return r
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestOutboundLimit(t *testing.T) {
+	opts := gwcfg.Options.Outbound
+	defer func() { gwcfg.Options.Outbound = opts }()
+	msg := func(path string, mate values.Metadata) *outboundMessage {
+		return newOutboundMessage(0, 0, path, []byte("x"), mate)
+	}
+	low := values.Metadata{gwcfg.ServiceMessageLow: "1"}
+	conflate := values.Metadata{gwcfg.ServiceMessageConflate: ""}
+	cases := []struct {
+		name   string
+		policy string
+		queue  []*outboundMessage
+		ok     bool
+		paths  []string
+	}{
+		{"under", gwcfg.OutboundPolicyDrop, []*outboundMessage{msg("a", nil), msg("b", nil)}, true, []string{"a", "b"}},
+		{"drop low", gwcfg.OutboundPolicyDrop, []*outboundMessage{msg("a", nil), msg("b", low), msg("c", nil)}, true, []string{"a", "c"}},
+		{"drop none", gwcfg.OutboundPolicyDrop, []*outboundMessage{msg("a", nil), msg("b", nil), msg("c", nil)}, false, nil},
+		{"conflate", gwcfg.OutboundPolicyConflate, []*outboundMessage{msg("a", conflate), msg("b", nil), msg("a", conflate)}, true, []string{"b", "a"}},
+		{"disconnect", gwcfg.OutboundPolicyDisconnect, []*outboundMessage{msg("a", low), msg("b", low), msg("c", low)}, false, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gwcfg.Options.Outbound = &gwcfg.Outbound{Messages: 2, Policy: c.policy}
+			box := &outbox{}
+			for _, m := range c.queue {
+				box.queue = append(box.queue, m)
+				box.bytes += len(m.body)
+			}
+			if ok := Outbound.limit(box); ok != c.ok {
+				t.Fatalf("limit:%v want:%v", ok, c.ok)
+			}
+			if !c.ok {
+				return
+			}
+			if len(box.queue) != len(c.paths) || box.bytes != len(c.paths) {
+				t.Fatalf("queue:%d bytes:%d", len(box.queue), box.bytes)
+			}
+			for i, m := range box.queue {
+				if m.path != c.paths[i] {
+					t.Fatalf("queue[%d]:%s want:%s", i, m.path, c.paths[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOutboundRemove(t *testing.T) {
+	sock := &cosnet.Socket{}
+	buffer := values.Metadata{gwcfg.ServiceMessageBuffer: "1"}
+	box := &outbox{sock: sock}
+	for _, m := range []*outboundMessage{
+		newOutboundMessage(0, 0, "a", []byte("1"), buffer),
+		newOutboundMessage(0, 0, "b", []byte("2"), nil),
+		newOutboundMessage(0, 0, "c", []byte("3"), buffer),
+	} {
+		box.queue = append(box.queue, m)
+		box.bytes += len(m.body)
+	}
+	Outbound.dict.Store(sock.Id(), box)
+	r := Outbound.Remove(sock)
+	if len(r) != 2 || r[0].path != "a" || r[1].path != "c" {
+		t.Fatalf("buffered messages:%v", r)
+	}
+	if n, _ := Outbound.Len(sock); n != 0 || Outbound.Remove(sock) != nil {
+		t.Fatal("outbox should be removed")
+	}
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// 长连接暂时断开时缓存推送,断线重连后按顺序补发,配置 gwcfg.Options.Pending
+// 只缓存 metadata 中带 _msg_buffer 的推送,缓存保存在 session 中,会话销毁时一起释放
+
+// SessionPlayerPendingName 推送缓存在 session 中的名称
+const SessionPlayerPendingName = "player.pending"
+
+var Pending = &pendings{}
+
+type pendingMessage struct {
+	*outboundMessage
+	time int64
+}
+
+type pending struct {
+	queue  []*pendingMessage
+	bytes  int
+	locker sync.Mutex
+}
+
+type pendings struct{}
+
+func (this *pendings) options() gwcfg.Pending {
+	if c := gwcfg.Options.Pending; c != nil {
+		return *c
+	}
+	return gwcfg.Pending{}
+}
+
+func (this *pendings) get(p *session.Data, create bool) (r *pending) {
+	if v, ok := p.Get(SessionPlayerPendingName).(*pending); ok || !create {
+		return v
+	}
+	p.Mutex(func(setter session.Setter) {
+		if v, ok := setter.Get(SessionPlayerPendingName).(*pending); ok {
+			r = v
+		} else {
+			r = &pending{}
+			setter.Set(SessionPlayerPendingName, r)
+		}
+	})
+	return
+}
+
+// Push 缓存推送,超出数量或者字节数时丢弃最早的推送
+func (this *pendings) Push(p *session.Data, m *outboundMessage) {
+	opts := this.options()
+	if opts.Messages <= 0 {
+		return
+	}
+	box := this.get(p, true)
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	box.expire(opts, time.Now().Unix())
+	box.queue = append(box.queue, &pendingMessage{outboundMessage: m, time: time.Now().Unix()})
+	box.bytes += len(m.body)
+	for len(box.queue) > opts.Messages || (opts.Bytes > 0 && box.bytes > opts.Bytes) {
+		box.shift()
+	}
+}
+
+// Flush 长连接恢复后按顺序补发缓存的推送
+func (this *pendings) Flush(p *session.Data, sock *cosnet.Socket) {
+	box := this.get(p, false)
+	if box == nil {
+		return
+	}
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	box.expire(this.options(), time.Now().Unix())
+	n := len(box.queue)
+	for _, m := range box.queue {
+		_ = Outbound.Send(sock, m.outboundMessage)
+	}
+	box.queue = nil
+	box.bytes = 0
+	if n > 0 {
+		logger.Debug("补发缓存的推送,GUID:%s 数量:%d", p.UUID(), n)
+	}
+}
+
+// Len 缓存的推送数量
+func (this *pendings) Len(p *session.Data) int {
+	box := this.get(p, false)
+	if box == nil {
+		return 0
+	}
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	return len(box.queue)
+}
+
+// expire 删除超过缓存时间的推送,需要加锁
+func (this *pending) expire(opts gwcfg.Pending, now int64) {
+	if opts.Expire <= 0 {
+		return
+	}
+	for len(this.queue) > 0 && now-this.queue[0].time > opts.Expire {
+		this.shift()
+	}
+}
+
+func (this *pending) shift() {
+	this.bytes -= len(this.queue[0].body)
+	this.queue[0] = nil
+	this.queue = this.queue[1:]
+}
@@ -0,0 +1,44 @@
+package players
+
+import (
+	"sync"
+	"time"
+)
+
+// 被踢下线的玩家在一段时间内禁止使用旧的重连秘钥(S2CSecret)恢复会话
+// 重新登录(Login)后解除,新的秘钥可以正常断线重连
+
+var blocked = sync.Map{}
+
+// Block 禁止 guid 断线重连 ttl 秒,ttl<=0 时不禁止
+func Block(guid string, ttl int64) {
+	if guid == "" || ttl <= 0 {
+		return
+	}
+	now := time.Now().Unix()
+	blocked.Range(func(k, v any) bool {
+		if v.(int64) <= now {
+			blocked.Delete(k)
+		}
+		return true
+	})
+	blocked.Store(guid, now+ttl)
+}
+
+// Blocked 是否禁止断线重连
+func Blocked(guid string) bool {
+	v, ok := blocked.Load(guid)
+	if !ok {
+		return false
+	}
+	if v.(int64) > time.Now().Unix() {
+		return true
+	}
+	blocked.Delete(guid)
+	return false
+}
+
+// Unblock 解除禁止,重新登录时调用
+func Unblock(guid string) {
+	blocked.Delete(guid)
+}
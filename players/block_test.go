@@ -0,0 +1,23 @@
+package players
+
+import "testing"
+
+func TestBlock(t *testing.T) {
+	Block("u1", 60)
+	Block("u2", 0)
+	if !Blocked("u1") || Blocked("u2") {
+		t.Fatal("u1 should be blocked, u2 not")
+	}
+	Unblock("u1")
+	if Blocked("u1") {
+		t.Fatal("u1 should be unblocked")
+	}
+	// 过期后自动解除
+	blocked.Store("u3", int64(1))
+	if Blocked("u3") {
+		t.Fatal("expired block")
+	}
+	if _, ok := blocked.Load("u3"); ok {
+		t.Fatal("expired block should be deleted")
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/gwcfg"
 )
 
 var players = sync.Map{}
@@ -27,6 +28,27 @@ func Range(fn func(*session.Data) bool) {
 	})
 }
 
+// Find 按 GUID 或者 UID 查找在线玩家,只有 UID 时需要遍历所有玩家
+func Find(guid, uid string) (r *session.Data) {
+	if guid != "" {
+		if r = Get(guid); r != nil && uid != "" && r.GetString(gwcfg.ServiceMetadataUID) != uid {
+			r = nil
+		}
+		return
+	}
+	if uid == "" {
+		return nil
+	}
+	Range(func(p *session.Data) bool {
+		if p.GetString(gwcfg.ServiceMetadataUID) == uid {
+			r = p
+			return false
+		}
+		return true
+	})
+	return
+}
+
 func Delete(p *session.Data) bool {
 	if p == nil {
 		return false
@@ -40,6 +62,7 @@ func Delete(p *session.Data) bool {
 }
 
 func Login(guid string, value values.Values) (token string, data *session.Data, err error) {
+	Unblock(guid) //踢下线后重新登录,旧秘钥随会话删除已经失效
 	data = session.NewData(guid, value)
 	i, loaded := players.LoadOrStore(guid, data)
 	if loaded {
@@ -6,6 +6,7 @@ import (
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/errors"
 )
 
 const (
@@ -55,6 +56,9 @@ func Reconnect(sock *cosnet.Socket, secret string) (data *session.Data, err erro
 	if err = s.Verify(secret); err != nil {
 		return
 	}
+	if Blocked(s.Data.UUID()) {
+		return nil, errors.ErrKicked
+	}
 	_, err = s.Refresh() //刷线TOKEN
 	data = s.Data
 	Replace(data, sock, sock.RemoteAddr().String())
@@ -0,0 +1,248 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosweb"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+// HTTP 推送,只开启短连接时玩家没有长连接,通过长轮询或者 SSE 接收 send,broadcast,频道等推送
+// GET Setting.Poll?wait=25,使用与代理请求相同的 token,请求头 Accept: text/event-stream 时使用 SSE
+// 第一次轮询后为会话创建推送缓存,两次轮询之间的推送保留在缓存中,超过 Idle 秒没有轮询时删除缓存
+
+// SessionPlayerPollName HTTP 推送缓存在 session 中的名称
+const SessionPlayerPollName = "player.poll"
+
+var Poll = &polls{}
+
+// PollMessage HTTP 推送的消息
+type PollMessage struct {
+	Path   string `json:"path"`
+	Index  int32  `json:"index,omitempty"`  //使用可靠推送时为 -seq
+	Body   any    `json:"body,omitempty"`   //JSON 原样返回,其他格式为 base64 字符串
+	Base64 bool   `json:"base64,omitempty"` //Body 不是 JSON,使用 base64(StdEncoding) 编码
+}
+
+func newPollMessage(m *outboundMessage) *PollMessage {
+	r := &PollMessage{Path: m.path, Index: m.rid}
+	if len(m.body) == 0 {
+		return r
+	}
+	if json.Valid(m.body) {
+		r.Body = json.RawMessage(m.body)
+	} else {
+		r.Body = base64.StdEncoding.EncodeToString(m.body)
+		r.Base64 = true
+	}
+	return r
+}
+
+type mailbox struct {
+	queue  []*outboundMessage
+	bytes  int
+	active int64         //最后一次轮询的时间
+	notify chan struct{} //有新的推送
+	locker sync.Mutex
+}
+
+type polls struct{}
+
+func (this *polls) options() gwcfg.Poll {
+	if c := gwcfg.Options.Poll; c != nil {
+		return *c
+	}
+	return gwcfg.Poll{}
+}
+
+func (this *polls) get(p *session.Data, create bool) (r *mailbox) {
+	if v, ok := p.Get(SessionPlayerPollName).(*mailbox); ok || !create {
+		return v
+	}
+	p.Mutex(func(setter session.Setter) {
+		if v, ok := setter.Get(SessionPlayerPollName).(*mailbox); ok {
+			r = v
+		} else {
+			r = &mailbox{notify: make(chan struct{}, 1), active: time.Now().Unix()}
+			setter.Set(SessionPlayerPollName, r)
+		}
+	})
+	return
+}
+
+// active 是否仍然在轮询,需要加锁
+func (this *polls) active(box *mailbox, opts gwcfg.Poll) bool {
+	return opts.Idle <= 0 || time.Now().Unix()-box.active <= opts.Idle
+}
+
+// Has 玩家是否通过 HTTP 接收推送
+func (this *polls) Has(p *session.Data) bool {
+	box := this.get(p, false)
+	if box == nil {
+		return false
+	}
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	return this.active(box, this.options())
+}
+
+// Push 放入推送缓存,玩家没有轮询时返回 false,超出数量或者字节数时丢弃最早的推送
+func (this *polls) Push(p *session.Data, m *outboundMessage) bool {
+	box := this.get(p, false)
+	if box == nil {
+		return false
+	}
+	opts := this.options()
+	if !this.push(box, m, opts) {
+		this.remove(p, box, opts)
+		return false
+	}
+	return true
+}
+
+func (this *polls) push(box *mailbox, m *outboundMessage, opts gwcfg.Poll) bool {
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	if !this.active(box, opts) {
+		return false
+	}
+	box.queue = append(box.queue, m)
+	box.bytes += len(m.body)
+	for len(box.queue) > 1 && ((opts.Messages > 0 && len(box.queue) > opts.Messages) || (opts.Bytes > 0 && box.bytes > opts.Bytes)) {
+		box.bytes -= len(box.queue[0].body)
+		box.queue[0] = nil
+		box.queue = box.queue[1:]
+	}
+	select {
+	case box.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// remove 删除不再轮询的 box,已经被替换或者重新开始轮询时不删除
+func (this *polls) remove(p *session.Data, box *mailbox, opts gwcfg.Poll) {
+	p.Mutex(func(setter session.Setter) {
+		if v, _ := setter.Get(SessionPlayerPollName).(*mailbox); v != box {
+			return
+		}
+		box.locker.Lock()
+		defer box.locker.Unlock()
+		if !this.active(box, opts) {
+			setter.Delete(SessionPlayerPollName)
+		}
+	})
+}
+
+// take 取出所有缓存的推送
+func (this *polls) take(box *mailbox) (r []*PollMessage) {
+	box.locker.Lock()
+	defer box.locker.Unlock()
+	box.active = time.Now().Unix()
+	for _, m := range box.queue {
+		r = append(r, newPollMessage(m))
+	}
+	box.queue = nil
+	box.bytes = 0
+	return
+}
+
+// poll HTTP 推送,长轮询返回 []*PollMessage,没有推送时等待 wait 秒
+func (this *HttpServer) poll(c *cosweb.Context) any {
+	ctx := HttpContent{Context: c}
+	p, err := ctx.Verify()
+	if err != nil {
+		return err
+	}
+	if Drain.Draining() {
+		return Drain.Error()
+	}
+	box := Poll.get(p, true)
+	// 可靠推送确认,SSE 重连时浏览器自动带上 Last-Event-ID
+	ack := c.GetString("ack", cosweb.RequestDataTypeQuery)
+	if ack == "" {
+		ack = c.Request.Header.Get("Last-Event-ID")
+	}
+	if v, ok := parseAck([]byte(ack)); ok && Stream.Enable() {
+		Stream.Ack(p, v)
+	}
+	opts := Poll.options()
+	if strings.Contains(c.Request.Header.Get("Accept"), "text/event-stream") {
+		this.sse(c, box, opts)
+		return nil
+	}
+	wait, _ := strconv.ParseInt(c.GetString("wait", cosweb.RequestDataTypeQuery), 10, 64)
+	if wait <= 0 || wait > opts.Wait {
+		wait = opts.Wait
+	}
+	if r := Poll.take(box); len(r) > 0 || wait <= 0 {
+		return r
+	}
+	timer := time.NewTimer(time.Duration(wait) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-box.notify:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+	return Poll.take(box)
+}
+
+// sse 使用 SSE 持续推送,直到客户端断开或者网关关闭
+func (this *HttpServer) sse(c *cosweb.Context, box *mailbox, opts gwcfg.Poll) {
+	flusher, ok := c.Response.(http.Flusher)
+	if !ok {
+		c.Response.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	header := c.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	c.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.Duration(opts.Keepalive) * time.Second
+	if keepalive <= 0 {
+		keepalive = 15 * time.Second
+	}
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+	for {
+		for _, m := range Poll.take(box) {
+			b, err := json.Marshal(m)
+			if err != nil {
+				continue
+			}
+			if m.Index != 0 {
+				_, err = fmt.Fprintf(c.Response, "id: %d\ndata: %s\n\n", -int64(m.Index), b)
+			} else {
+				_, err = fmt.Fprintf(c.Response, "data: %s\n\n", b)
+			}
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		select {
+		case <-box.notify:
+		case <-ticker.C:
+			if Drain.Draining() {
+				return
+			}
+			if _, err := fmt.Fprint(c.Response, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestPollMessage(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   []byte
+		want   any
+		base64 bool
+	}{
+		{"empty", nil, nil, false},
+		{"json", []byte(`{"a":1}`), json.RawMessage(`{"a":1}`), false},
+		{"text", []byte("hello"), base64.StdEncoding.EncodeToString([]byte("hello")), true},
+		{"binary", []byte{0xff, 0x00, 0x01}, base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0x01}), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := newPollMessage(newOutboundMessage(0, 0, "push", c.body, nil))
+			if m.Base64 != c.base64 {
+				t.Fatalf("base64:%v", m.Base64)
+			}
+			got, _ := json.Marshal(m.Body)
+			want, _ := json.Marshal(c.want)
+			if string(got) != string(want) {
+				t.Fatalf("body:%s want:%s", got, want)
+			}
+		})
+	}
+}
+
+// 第一次轮询创建缓存之后,下一次轮询之前的推送不能因为 idle 被丢弃
+func TestPollFirstPush(t *testing.T) {
+	opts := gwcfg.Options.Poll
+	defer func() { gwcfg.Options.Poll = opts }()
+	gwcfg.Options.Poll = &gwcfg.Poll{Idle: 60}
+	p := session.NewData("poll", nil)
+	box := Poll.get(p, true)
+	if !Poll.Has(p) {
+		t.Fatalf("new mailbox not active")
+	}
+	if !Poll.Push(p, newOutboundMessage(0, 0, "push", []byte("x"), nil)) {
+		t.Fatalf("push dropped")
+	}
+	if r := Poll.take(box); len(r) != 1 || r[0].Path != "push" || !r[0].Base64 {
+		t.Fatalf("take:%v", r)
+	}
+}
+
+// 不再轮询时删除缓存,已经被新的缓存替换时不删除
+func TestPollRemove(t *testing.T) {
+	opts := gwcfg.Options.Poll
+	defer func() { gwcfg.Options.Poll = opts }()
+	gwcfg.Options.Poll = &gwcfg.Poll{Idle: 60}
+	p := session.NewData("poll-remove", nil)
+	old := Poll.get(p, true)
+	old.active -= 120
+	if Poll.Push(p, newOutboundMessage(0, 0, "push", []byte("x"), nil)) {
+		t.Fatalf("idle mailbox should not accept push")
+	}
+	if Poll.get(p, false) != nil {
+		t.Fatalf("idle mailbox not removed")
+	}
+	box := Poll.get(p, true)
+	Poll.remove(p, old, Poll.options())
+	if Poll.get(p, false) != box {
+		t.Fatalf("new mailbox removed by stale push")
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosgo/values"
 	"github.com/hwcer/cosrpc"
-	"github.com/hwcer/cosrpc/client"
 	"github.com/hwcer/logger"
 )
 
@@ -38,6 +37,12 @@ func proxyRequest(proxy Proxy, path string) (reply []byte, err error) {
 		}
 	}()
 
+	// 正在关闭时不再接受新请求
+	if !Drain.Add() {
+		return nil, Drain.Error()
+	}
+	defer Drain.Done()
+
 	// 获取请求元数据和创建响应元数据
 	req := proxy.Metadata()
 	res := make(values.Metadata)
@@ -56,6 +61,10 @@ func proxyRequest(proxy Proxy, path string) (reply []byte, err error) {
 	if p, err = Access.Verify(proxy, req, servicePath, serviceMethod); err != nil {
 		return nil, err
 	}
+	// 接口限流
+	if err = Limiter.Verify(proxy, p, gwcfg.Authorize.Format(servicePath, serviceMethod)); err != nil {
+		return nil, err
+	}
 
 	// 设置网关地址和用户级别微服务筛选器
 	req.Set(gwcfg.ServiceMetadataGateway, cosrpc.Address().Encode())
@@ -96,7 +105,7 @@ func proxyRequest(proxy Proxy, path string) (reply []byte, err error) {
 		serviceMethod = registry.Join(gwcfg.Options.Gate.Prefix, serviceMethod)
 	}
 	// 调用远程服务
-	if err = client.CallWithMetadata(req, res, servicePath, serviceMethod, body, &reply); err != nil {
+	if err = Setting.Caller(req, res, servicePath, serviceMethod, body, &reply); err != nil {
 		return nil, err
 	}
 
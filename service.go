@@ -9,8 +9,6 @@ import (
 	"github.com/hwcer/gateway/gwcfg"
 	"github.com/hwcer/gateway/players"
 
-	"github.com/hwcer/cosgo/session"
-	"github.com/hwcer/cosnet"
 	"github.com/hwcer/cosrpc"
 	"github.com/hwcer/cosrpc/server"
 	"github.com/hwcer/logger"
@@ -22,6 +20,10 @@ func init() {
 	Register(send)
 	Register(write)
 	Register(broadcast)
+	Register(multicast)
+	Register(kick)
+	Register(connections)
+	Register(maintenance)
 }
 
 // Register 注册协议，用于服务器推送消息
@@ -33,17 +35,22 @@ func Register(i any, prefix ...string) {
 
 // 仅仅 在登录接口本身 需要提前对SOCKET发送信息时使用
 func write(c *cosrpc.Context) any {
-	id := c.GetMetadata(gwcfg.ServiceMetadataSocketId)
+	return Write(values.Metadata(c.Metadata()), c.Bytes())
+}
+
+// Write 按 Socket ID 直接推送,进程内调用,参数与 RPC write 接口相同
+func Write(mate values.Metadata, body []byte) (err error) {
+	id := mate.Get(gwcfg.ServiceMetadataSocketId)
 	if id == "" {
-		return c.Error("socket id not found")
+		return values.Error("socket id not found")
 	}
-	path := c.GetMetadata(gwcfg.ServiceMessagePath)
+	path := mate.Get(gwcfg.ServiceMessagePath)
 	i, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		logger.Debug("Socket id error,消息丢弃,Socket:%s PATH:%s ", id, path)
 		return nil
 	}
-	sock := cosnet.Get(i)
+	sock := TCP.Sockets.Get(i)
 	if sock == nil {
 		logger.Debug("长链接不在线,消息丢弃,Socket:%s PATH:%s ", id, path)
 		return nil
@@ -51,9 +58,7 @@ func write(c *cosrpc.Context) any {
 	if len(path) == 0 {
 		return nil //仅仅设置信息，不需要发送
 	}
-	mate := values.Metadata(c.Metadata())
 	var flag = message.Flag(mate.GetInt32(gwcfg.ServiceResponseFlag))
-	body := c.Bytes()
 	if Setting.Response != nil {
 		ctx := NewContextWithSocket(path, &flag, mate, sock)
 		body, err = Setting.Response(ctx, body)
@@ -63,14 +68,19 @@ func write(c *cosrpc.Context) any {
 		return err
 	}
 	rid := mate.GetInt32(gwcfg.ServiceMetadataRequestId)
-	_ = sock.Send(flag, rid, path, body)
+	_ = Outbound.Send(sock, newOutboundMessage(flag, rid, path, body, mate))
 	return nil
 }
 
 // send 消息推送
 func send(c *cosrpc.Context) any {
-	uid := c.GetMetadata(gwcfg.ServiceMetadataUID)
-	guid := c.GetMetadata(gwcfg.ServiceMetadataGUID)
+	return Send(values.Metadata(c.Metadata()), c.Bytes())
+}
+
+// Send 按 GUID/UID 推送消息,进程内调用,参数与 RPC send 接口相同
+func Send(mate values.Metadata, body []byte) (err error) {
+	uid := mate.Get(gwcfg.ServiceMetadataUID)
+	guid := mate.Get(gwcfg.ServiceMetadataGUID)
 
 	p := players.Get(guid)
 	if p == nil {
@@ -84,15 +94,15 @@ func send(c *cosrpc.Context) any {
 		}
 	}
 
-	mate := values.Metadata(c.Metadata())
 	if _, ok := mate[gwcfg.ServicePlayerLogout]; ok {
 		players.Delete(p)
 		return nil
 	}
-	path := c.GetMetadata(gwcfg.ServiceMessagePath)
+	path := mate.Get(gwcfg.ServiceMessagePath)
 
 	sock := players.Socket(p)
-	if sock == nil {
+	_, buffer := mate[gwcfg.ServiceMessageBuffer]
+	if sock == nil && !buffer && !Stream.Reliable(p) && !Poll.Has(p) {
 		logger.Debug("长链接不在线,消息丢弃,UID:%s GUID:%s PATH:%s ", uid, guid, path)
 		return nil
 	}
@@ -101,28 +111,56 @@ func send(c *cosrpc.Context) any {
 		return nil //仅仅设置信息，不需要发送
 	}
 
-	var err error
 	flag := message.Flag(mate.GetInt32(gwcfg.ServiceResponseFlag))
-	body := c.Bytes()
 	if Setting.Response != nil {
-		ctx := NewContextWithSocket(path, &flag, mate, sock)
+		ctx := NewContextWithSession(path, &flag, mate, p, sock)
 		body, err = Setting.Response(ctx, body)
 	}
 	if err != nil {
 		return err
 	}
 	rid := mate.GetInt32(gwcfg.ServiceMetadataRequestId)
+	m := newOutboundMessage(flag, rid, path, body, mate)
 	//logger.Debug("推送消息  GUID:%s RID:%d PATH:%s", guid, rid, path)
-	_ = sock.Send(flag, rid, path, body)
+	if !pushPlayer(p, sock, m) && buffer && !Stream.Reliable(p) {
+		Pending.Push(p, m)
+		if sock = players.Socket(p); sock != nil {
+			Pending.Flush(p, sock) //缓存期间已经重连
+		}
+	}
 	return nil
 }
 
-// broadcast 全服广播
+// broadcast 全服广播,metadata 中有 _msg_wait 时等待推送完成并返回 BroadcastResult
 func broadcast(c *cosrpc.Context) any {
-	path := c.GetMetadata(gwcfg.ServiceMessagePath)
+	mate := values.Metadata(c.Metadata())
+	job, err := newBroadcastJob(mate, c.Bytes())
+	if err != nil {
+		return err
+	}
+	if err = Broadcaster.push(job); err != nil {
+		return err
+	}
+	if _, ok := mate[gwcfg.ServiceMessageWait]; ok {
+		return job.wait(Broadcaster.waitTimeout())
+	}
+	return nil
+}
+
+// Broadcast 全服广播,进程内调用,参数与 RPC broadcast 接口相同,加入队列后立即返回
+func Broadcast(mate values.Metadata, body []byte) (err error) {
+	job, err := newBroadcastJob(mate, body)
+	if err != nil {
+		return err
+	}
+	return Broadcaster.push(job)
+}
+
+func newBroadcastJob(mate values.Metadata, body []byte) (job *broadcastJob, err error) {
+	path := mate.Get(gwcfg.ServiceMessagePath)
 	//logger.Debug("广播消息:%v", path)
 
-	ignore := c.GetMetadata(gwcfg.ServiceMessageIgnore)
+	ignore := mate.Get(gwcfg.ServiceMessageIgnore)
 	ignoreMap := make(map[string]struct{})
 	if ignore != "" {
 		arr := strings.Split(ignore, ",")
@@ -130,32 +168,26 @@ func broadcast(c *cosrpc.Context) any {
 			ignoreMap[v] = struct{}{}
 		}
 	}
-	mate := values.Metadata(c.Metadata())
+	filter, err := gwcfg.ParseFilter(mate)
+	if err != nil {
+		return nil, err
+	}
 	flag := message.Flag(mate.GetInt32(gwcfg.ServiceResponseFlag))
 	flag.Set(message.FlagNoreply)
 	flag.Set(message.FlagBroadcast)
 
-	var err error
-	body := c.Bytes()
 	if Setting.Response != nil {
 		ctx := NewContextWithSocket(path, &flag, mate, nil)
 		body, err = Setting.Response(ctx, body)
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	job = &broadcastJob{message: newOutboundMessage(flag, 0, path, body, mate), ignore: ignoreMap, filter: filter}
+	return job, nil
+}
 
-	players.Range(func(p *session.Data) bool {
-		uid := p.GetString(gwcfg.ServiceMetadataUID)
-		if _, ok := ignoreMap[uid]; ok {
-			return true
-		}
-		//CookiesUpdate(mate, p)
-		//Emitter.emit(EventTypeBroadcast, p, path, nil)
-		if sock := players.Socket(p); sock != nil {
-			_ = sock.Send(flag, 0, path, body, false)
-		}
-		return true
-	})
-	return nil
+// connections 长连接统计,查看连接数和被限制的连接
+func connections(c *cosrpc.Context) any {
+	return Conns.Stats()
 }
@@ -14,6 +14,8 @@ import (
 	"github.com/hwcer/cosgo/registry"
 	"github.com/hwcer/cosgo/session"
 	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/cosrpc"
+	"github.com/hwcer/cosrpc/client"
 )
 
 func init() {
@@ -44,18 +46,31 @@ type S2CReplaced interface {
 	S2CReplaced(sock *cosnet.Socket, ip string)
 }
 
+// S2CDisconnect 推送积压断开连接时也会调用,发送时不能阻塞(sock.Send 最后一个参数为 false)
+type S2CDisconnect interface {
+	S2CDisconnect(sock *cosnet.Socket, reason error)
+}
+
 var Setting = struct {
-	Router       router                                         //路由处理规则
-	C2SOAuth     string                                         //网关登录,置空时不启用默认验证方式
-	G2SOAuth     string                                         //游戏服登录验证,网关登录登录成功后继续使用GUID去游戏服验证,留空不进行验证
-	Request      func(c *Context, args []byte) ([]byte, error)  //网关转发消息时,如果数据有加密，可以在解密之后转发
-	Response     func(c *Context, reply []byte) ([]byte, error) //rpc 返回数据时,推送消息时只有Session,广播时 Context为NIL
-	Serialize    func(accept Accept, reply any) ([]byte, error) //序列化方式
-	S2CSecret    any                                            //登录成功时给客户端发送秘钥,nil不处理; string时作为路径使用MagicNumberPathJson发送JSON; 或实现S2CSecret接口自定义处理
-	S2CReplaced  any                                            //被顶号时给客户端发送顶号提示,nil不处理; string时作为路径使用MagicNumberPathJson发送JSON; 或实现S2CReplaced接口自定义处理
-	C2SHeartbeat string                                         //客户端心跳包名
-	C2SReconnect string                                         //客户端断线重连包名
-	C2SOAuthArgs func() token.Args                              //收到 C2SOAuth 用于解析 参数的方法
+	Router         router                                         //路由处理规则
+	C2SOAuth       string                                         //网关登录,置空时不启用默认验证方式
+	G2SOAuth       string                                         //游戏服登录验证,网关登录登录成功后继续使用GUID去游戏服验证,留空不进行验证
+	Request        func(c *Context, args []byte) ([]byte, error)  //网关转发消息时,如果数据有加密，可以在解密之后转发
+	Response       func(c *Context, reply []byte) ([]byte, error) //rpc 返回数据时,推送消息时只有Session,广播时 Context为NIL
+	Serialize      func(accept Accept, reply any) ([]byte, error) //序列化方式
+	S2CSecret      any                                            //登录成功时给客户端发送秘钥,nil不处理; string时作为路径使用MagicNumberPathJson发送JSON; 或实现S2CSecret接口自定义处理
+	S2CReplaced    any                                            //被顶号时给客户端发送顶号提示,nil不处理; string时作为路径使用MagicNumberPathJson发送JSON; 或实现S2CReplaced接口自定义处理
+	S2CDisconnect  any                                            //网关主动断开连接前给客户端发送原因,nil(默认)不处理; string时作为路径使用MagicNumberPathJson发送错误码; 或实现S2CDisconnect接口自定义处理
+	S2CMaintenance string                                         //维护计划开始前给在线玩家推送维护公告(gwcfg.MaintenanceNotice)的路径,空时不推送
+	C2SHeartbeat   string                                         //客户端心跳包名
+	C2SReconnect   string                                         //客户端断线重连包名
+	C2SAck         string                                         //客户端可靠推送确认包名,开启 Options.Reliable 时使用
+	Health         string                                         //HTTP健康检查路由,如 "health",返回 HealthOK,正在关闭时返回 503 HealthDraining,默认不启用
+	Poll           string                                         //HTTP推送(长轮询/SSE)路由,如 "poll",默认不启用
+	Admin          string                                         //HTTP管理接口路由前缀,如 "_admin",使用开发者秘钥认证,默认不启用
+	C2SOAuthArgs   func() token.Args                              //收到 C2SOAuth 用于解析 参数的方法
+	Caller         caller                                         //调用后端服务,默认使用 cosrpc client,测试时可替换成进程内实现
+	Services       func() []string                                //需要网关代理的服务列表,默认 cosrpc.Service
 }{
 	Router:       defaultRouter,
 	C2SOAuth:     "oauth",
@@ -64,11 +79,22 @@ var Setting = struct {
 	S2CReplaced:  "S2CReplaced",
 	C2SHeartbeat: "C2SHeartbeat",
 	C2SReconnect: "C2SReconnect",
+	C2SAck:       "C2SAck",
 	C2SOAuthArgs: token.NewArgs,
+	Caller:       defaultCaller,
+	Services:     defaultServices,
 }
 
+// 健康检查返回内容
+const (
+	HealthOK       = "ok"
+	HealthDraining = "draining"
+)
+
 type router func(path string, req values.Metadata) (servicePath, serviceMethod string, err error)
 
+type caller func(req, res values.Metadata, servicePath, serviceMethod string, args, reply any) error
+
 // Router 默认路由处理方式
 func defaultRouter(path string, req values.Metadata) (servicePath, serviceMethod string, err error) {
 	path = strings.TrimPrefix(path, "/")
@@ -87,3 +113,14 @@ func defaultSerialize(accept Accept, reply any) ([]byte, error) {
 	v := values.Parse(reply)
 	return b.Marshal(v)
 }
+
+func defaultCaller(req, res values.Metadata, servicePath, serviceMethod string, args, reply any) error {
+	return client.CallWithMetadata(req, res, servicePath, serviceMethod, args, reply)
+}
+
+func defaultServices() (r []string) {
+	for k := range cosrpc.Service {
+		r = append(r, k)
+	}
+	return
+}
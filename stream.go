@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// 可靠推送,配置 gwcfg.Options.Reliable.Enable 开启,客户端在登录(C2SOAuth 参数 reliable)或断线重连(ReconnectArgs)时声明使用,
+// 只有声明使用的会话分配序号和保留推送,其他会话不受影响;
+// 每个会话的推送分配递增的序号,通过消息的 Index 下发(负数,-seq,与客户端请求的 Index 区分),
+// 推送在确认前保留在 session 中,长连接断开期间的推送同样保留;
+// 客户端通过 C2SAck 或者 C2SHeartbeat 的 body 确认已经收到的序号,
+// C2SReconnect 使用 ReconnectArgs 带上最后确认的序号,网关补发之后的推送,无法补发时返回 Resync;
+// 分配序号,发送和补发使用同一个锁,新连接补发完成前的推送只保留,由补发按顺序发送
+
+// SessionPlayerStreamName 可靠推送在 session 中的名称
+const SessionPlayerStreamName = "player.stream"
+
+var Stream = &streams{}
+
+// ReconnectArgs C2SReconnect 使用 JSON 时的参数
+type ReconnectArgs struct {
+	Secret string `json:"secret"`
+	Ack    int64  `json:"ack"` //最后确认的序号
+}
+
+// ReconnectReply C2SReconnect 使用 ReconnectArgs 时的返回
+type ReconnectReply struct {
+	Seq    int64 `json:"seq"`    //当前最新的序号
+	Replay int   `json:"replay"` //补发的推送数量
+	Resync bool  `json:"resync"` //推送已经丢失,客户端需要重新拉取全量数据
+}
+
+type streamMessage struct {
+	*outboundMessage
+	seq  int64
+	time int64
+}
+
+type stream struct {
+	seq    int64
+	queue  []*streamMessage //未确认的推送,按序号排列
+	bytes  int
+	lost   int64          //因为超出限制被丢弃的最大序号
+	sock   *cosnet.Socket //已经完成补发的长连接,其他连接只保留推送
+	locker sync.Mutex
+}
+
+type streams struct{}
+
+func (this *streams) options() gwcfg.Reliable {
+	if c := gwcfg.Options.Reliable; c != nil {
+		return *c
+	}
+	return gwcfg.Reliable{}
+}
+
+// Enable 是否开启可靠推送
+func (this *streams) Enable() bool {
+	c := gwcfg.Options.Reliable
+	return c != nil && c.Enable
+}
+
+// Reliable 会话是否使用可靠推送
+func (this *streams) Reliable(p *session.Data) bool {
+	return this.Enable() && this.get(p, false) != nil
+}
+
+func (this *streams) get(p *session.Data, create bool) (r *stream) {
+	if v, ok := p.Get(SessionPlayerStreamName).(*stream); ok || !create {
+		return v
+	}
+	p.Mutex(func(setter session.Setter) {
+		if v, ok := setter.Get(SessionPlayerStreamName).(*stream); ok {
+			r = v
+		} else {
+			r = &stream{}
+			setter.Set(SessionPlayerStreamName, r)
+		}
+	})
+	return
+}
+
+// Push 分配序号并保留,sock 为已经完成补发的长连接时发送,为空时放入 HTTP 推送缓存,
+// 返回是否已经发送或保留
+func (this *streams) Push(p *session.Data, sock *cosnet.Socket, m *outboundMessage) bool {
+	opts := this.options()
+	s := this.get(p, true)
+	now := time.Now().Unix()
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.seq++
+	r := *m
+	r.rid = -int32(s.seq)
+	s.queue = append(s.queue, &streamMessage{outboundMessage: &r, seq: s.seq, time: now})
+	s.bytes += len(r.body)
+	for len(s.queue) > 0 {
+		first := s.queue[0]
+		if (opts.Messages > 0 && len(s.queue) > opts.Messages) || (opts.Bytes > 0 && s.bytes > opts.Bytes) || (opts.Expire > 0 && now-first.time > opts.Expire) {
+			s.lost = first.seq
+			s.shift()
+		} else {
+			break
+		}
+	}
+	switch {
+	case sock == nil:
+		return Poll.Push(p, &r)
+	case sock == s.sock:
+		return Outbound.Send(sock, &r) == nil
+	default:
+		return true //新连接还没有补发,由补发发送
+	}
+}
+
+// Ack 确认已经收到的序号,大于最新序号时忽略
+func (this *streams) Ack(p *session.Data, ack int64) {
+	s := this.get(p, false)
+	if s == nil {
+		return
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if ack > s.seq {
+		return
+	}
+	for len(s.queue) > 0 && s.queue[0].seq <= ack {
+		s.shift()
+	}
+}
+
+// Login 登录时按客户端声明开启或者关闭可靠推送,开启时之前保留的推送全部补发,HTTP 登录时 sock 为空
+func (this *streams) Login(p *session.Data, sock *cosnet.Socket, reliable bool) {
+	if !this.Enable() || !reliable {
+		this.Close(p)
+		return
+	}
+	s := this.get(p, true)
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.replay(sock, 0)
+}
+
+// Close 客户端没有声明使用可靠推送,删除保留的推送
+func (this *streams) Close(p *session.Data) {
+	if this.get(p, false) == nil {
+		return
+	}
+	p.Mutex(func(setter session.Setter) {
+		setter.Delete(SessionPlayerStreamName)
+	})
+}
+
+// Replay 断线重连后补发 ack 之后的推送,丢失时返回 Resync
+func (this *streams) Replay(p *session.Data, sock *cosnet.Socket, ack int64) *ReconnectReply {
+	s := this.get(p, true)
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	r := &ReconnectReply{Seq: s.seq}
+	if ack > s.seq || ack < s.lost {
+		r.Resync = true
+		s.sock = sock
+		logger.Debug("可靠推送无法补发,GUID:%s ACK:%d SEQ:%d LOST:%d", p.UUID(), ack, s.seq, s.lost)
+		return r
+	}
+	r.Replay = s.replay(sock, ack)
+	return r
+}
+
+// replay 发送 ack 之后的推送,之后的推送直接发送给 sock,需要加锁
+func (this *stream) replay(sock *cosnet.Socket, ack int64) (n int) {
+	this.sock = sock
+	if sock == nil {
+		return
+	}
+	for _, m := range this.queue {
+		if m.seq > ack {
+			_ = Outbound.Send(sock, m.outboundMessage)
+			n++
+		}
+	}
+	return
+}
+
+func (this *stream) shift() {
+	this.bytes -= len(this.queue[0].body)
+	this.queue[0] = nil
+	this.queue = this.queue[1:]
+}
+
+// parseAck C2SAck,C2SHeartbeat 的 body,数字或者数字字符串
+func parseAck(body []byte) (int64, bool) {
+	s := strings.Trim(strings.TrimSpace(string(body)), `"`)
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+// pushPlayer 推送给玩家,使用可靠推送的会话分配序号,sock 为空时放入 HTTP 推送缓存
+// 返回是否已经发送或进入发送队列,积压超出限制被断开时返回 false
+func pushPlayer(p *session.Data, sock *cosnet.Socket, m *outboundMessage) bool {
+	if m.rid == 0 && Stream.Reliable(p) {
+		return Stream.Push(p, sock, m)
+	}
+	if sock == nil {
+		return Poll.Push(p, m)
+	}
+	return Outbound.Send(sock, m) == nil
+}
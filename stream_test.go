@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/hwcer/cosgo/session"
+	"github.com/hwcer/cosnet"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func streamPush(t *testing.T, p *session.Data, sock *cosnet.Socket, n int) {
+	for i := 0; i < n; i++ {
+		if !pushPlayer(p, sock, newOutboundMessage(0, 0, "push", []byte("x"), nil)) {
+			t.Fatalf("push %d failed", i)
+		}
+	}
+}
+
+func TestStreamOptIn(t *testing.T) {
+	opts := gwcfg.Options.Reliable
+	defer func() { gwcfg.Options.Reliable = opts }()
+	gwcfg.Options.Reliable = &gwcfg.Reliable{Enable: true}
+	sock := &cosnet.Socket{}
+	p := session.NewData("opt-in", nil)
+	streamPush(t, p, sock, 1)
+	if Stream.Reliable(p) || Stream.get(p, false) != nil {
+		t.Fatalf("stream created without opt-in")
+	}
+	Stream.Login(p, sock, true)
+	if !Stream.Reliable(p) {
+		t.Fatalf("stream not opened")
+	}
+	streamPush(t, p, sock, 2)
+	if s := Stream.get(p, false); s.seq != 2 || len(s.queue) != 2 || s.queue[1].rid != -2 {
+		t.Fatalf("seq:%d queue:%d", s.seq, len(s.queue))
+	}
+	Stream.Login(p, sock, false)
+	if Stream.Reliable(p) {
+		t.Fatalf("stream not closed")
+	}
+	gwcfg.Options.Reliable.Enable = false
+	Stream.Login(p, sock, true)
+	if Stream.Reliable(p) {
+		t.Fatalf("stream opened while disabled")
+	}
+}
+
+func TestStreamAck(t *testing.T) {
+	opts := gwcfg.Options.Reliable
+	defer func() { gwcfg.Options.Reliable = opts }()
+	gwcfg.Options.Reliable = &gwcfg.Reliable{Enable: true}
+	sock := &cosnet.Socket{}
+	p := session.NewData("ack", nil)
+	Stream.Login(p, sock, true)
+	streamPush(t, p, sock, 3)
+	s := Stream.get(p, false)
+	Stream.Ack(p, 2)
+	if len(s.queue) != 1 || s.queue[0].seq != 3 || s.bytes != 1 {
+		t.Fatalf("queue:%d bytes:%d", len(s.queue), s.bytes)
+	}
+	Stream.Ack(p, 10) //大于最新序号,忽略
+	if len(s.queue) != 1 {
+		t.Fatalf("queue:%d", len(s.queue))
+	}
+	Stream.Ack(p, 3)
+	if len(s.queue) != 0 || s.bytes != 0 {
+		t.Fatalf("queue:%d bytes:%d", len(s.queue), s.bytes)
+	}
+}
+
+func TestStreamReplay(t *testing.T) {
+	opts := gwcfg.Options.Reliable
+	defer func() { gwcfg.Options.Reliable = opts }()
+	gwcfg.Options.Reliable = &gwcfg.Reliable{Enable: true, Messages: 3}
+	old, sock := &cosnet.Socket{}, &cosnet.Socket{}
+	p := session.NewData("replay", nil)
+	Stream.Login(p, old, true)
+	streamPush(t, p, old, 5)
+	cases := []struct {
+		name   string
+		ack    int64
+		replay int
+		resync bool
+	}{
+		{"replay", 3, 2, false},
+		{"all", 2, 3, false},
+		{"lost", 1, 0, true},
+		{"ahead", 6, 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := Stream.Replay(p, sock, c.ack)
+			if r.Seq != 5 || r.Replay != c.replay || r.Resync != c.resync {
+				t.Fatalf("seq:%d replay:%d resync:%v", r.Seq, r.Replay, r.Resync)
+			}
+		})
+	}
+}
+
+// 新连接补发之前的推送只保留,补发时按序号发送
+func TestStreamReplayAttach(t *testing.T) {
+	opts := gwcfg.Options.Reliable
+	defer func() { gwcfg.Options.Reliable = opts }()
+	gwcfg.Options.Reliable = &gwcfg.Reliable{Enable: true}
+	old, sock := &cosnet.Socket{}, &cosnet.Socket{}
+	p := session.NewData("attach", nil)
+	Stream.Login(p, old, true)
+	streamPush(t, p, old, 2)
+	streamPush(t, p, sock, 2) //重连后,补发之前
+	s := Stream.get(p, false)
+	if s.sock != old || s.seq != 4 {
+		t.Fatalf("sock attached before replay, seq:%d", s.seq)
+	}
+	if r := Stream.Replay(p, sock, 2); r.Replay != 2 || r.Resync {
+		t.Fatalf("replay:%d resync:%v", r.Replay, r.Resync)
+	}
+	if s.sock != sock {
+		t.Fatalf("sock not attached after replay")
+	}
+}
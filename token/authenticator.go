@@ -0,0 +1,129 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 内置认证方式
+const (
+	AuthenticatorAccess    = "access"    //平台登录凭证,gcm 或者 jwt
+	AuthenticatorDeveloper = "developer" //GM 快速登录
+)
+
+// Authenticator 登录认证方式,验证客户端参数并返回账号信息
+type Authenticator interface {
+	Authenticate(args Args) (*Result, error)
+}
+
+// AuthenticatorWithIP 可选接口,需要客户端地址的认证方式实现,VerifyWithIP 直接传入客户端地址,
+// 不依赖参数是否实现 ArgsAddress
+type AuthenticatorWithIP interface {
+	AuthenticateWithIP(args Args, ip string) (*Result, error)
+}
+
+// AuthenticatorFunc 使用函数实现 Authenticator
+type AuthenticatorFunc func(args Args) (*Result, error)
+
+func (f AuthenticatorFunc) Authenticate(args Args) (*Result, error) {
+	return f(args)
+}
+
+// AuthenticatorIPFunc 使用函数实现 AuthenticatorWithIP,通过 Authenticate 调用时使用 ArgsAddressOf(args)
+type AuthenticatorIPFunc func(args Args, ip string) (*Result, error)
+
+func (f AuthenticatorIPFunc) Authenticate(args Args) (*Result, error) {
+	return f(args, ArgsAddressOf(args))
+}
+func (f AuthenticatorIPFunc) AuthenticateWithIP(args Args, ip string) (*Result, error) {
+	return f(args, ip)
+}
+
+// HttpDoer 第三方 SDK 验证使用的 HTTP 客户端,测试时可以替换 HttpClient
+type HttpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var HttpClient HttpDoer = &http.Client{Timeout: 5 * time.Second}
+
+// HttpResponseLimit 第三方 SDK 返回结果的最大字节数,超出时认证失败
+var HttpResponseLimit int64 = 1 << 20
+
+// HttpAuthenticator 通过 HttpClient 调用第三方 SDK 接口验证登录票据
+type HttpAuthenticator struct {
+	Request  func(args Args) (*http.Request, error)        //根据客户端参数创建请求
+	Response func(args Args, body []byte) (*Result, error) //解析 SDK 返回结果,为空时按 JSON 解析为 Result
+}
+
+func (a *HttpAuthenticator) Authenticate(args Args) (*Result, error) {
+	req, err := a.Request(args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authenticator http status:%d", res.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, HttpResponseLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > HttpResponseLimit {
+		return nil, fmt.Errorf("authenticator http response too large")
+	}
+	if a.Response != nil {
+		return a.Response(args, body)
+	}
+	r := &Result{}
+	if err = json.Unmarshal(body, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+var Authenticators = authenticators{dict: map[string]Authenticator{}}
+
+func init() {
+	Authenticators.Register(AuthenticatorAccess, AuthenticatorFunc(verifyAccess))
+	Authenticators.Register(AuthenticatorDeveloper, AuthenticatorIPFunc(verifyDeveloper))
+}
+
+type authenticators struct {
+	dict   map[string]Authenticator
+	locker sync.RWMutex
+}
+
+// Register 注册认证方式,同名覆盖,可以替换内置方式
+func (this *authenticators) Register(name string, a Authenticator) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	this.dict[name] = a
+}
+
+func (this *authenticators) Get(name string) Authenticator {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.dict[name]
+}
+
+func authenticatorType(args Args) string {
+	if t, ok := args.(ArgsType); ok {
+		if name := t.GetType(); name != "" {
+			return name
+		}
+	}
+	if args.GetSecret() != "" {
+		return AuthenticatorDeveloper
+	}
+	return AuthenticatorAccess
+}
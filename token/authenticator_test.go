@@ -0,0 +1,90 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type httpDoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpDoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHttpAuthenticator(t *testing.T) {
+	client, limit := HttpClient, HttpResponseLimit
+	defer func() { HttpClient, HttpResponseLimit = client, limit }()
+	HttpResponseLimit = 64
+	a := &HttpAuthenticator{
+		Request: func(args Args) (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, "http://sdk.test/verify?ticket="+args.GetAccess(), nil)
+		},
+	}
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		openid string
+		ok     bool
+	}{
+		{"success", http.StatusOK, `{"openid":"u1"}`, "u1", true},
+		{"status", http.StatusForbidden, `{"openid":"u1"}`, "", false},
+		{"too large", http.StatusOK, `{"openid":"` + strings.Repeat("u", 64) + `"}`, "", false},
+		{"invalid json", http.StatusOK, `{"openid":`, "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			HttpClient = httpDoerFunc(func(req *http.Request) (*http.Response, error) {
+				if v := req.URL.Query().Get("ticket"); v != "t1" {
+					return nil, fmt.Errorf("ticket:%s", v)
+				}
+				return &http.Response{StatusCode: c.status, Body: io.NopCloser(strings.NewReader(c.body))}, nil
+			})
+			r, err := a.Authenticate(&ArgsDefault{Access: "t1"})
+			if c.ok != (err == nil) {
+				t.Fatalf("ok:%v err:%v", c.ok, err)
+			}
+			if c.ok && r.Openid != c.openid {
+				t.Fatalf("openid:%s want:%s", r.Openid, c.openid)
+			}
+		})
+	}
+}
+
+// 自定义 Response 解析 SDK 返回结果
+func TestHttpAuthenticatorResponse(t *testing.T) {
+	client := HttpClient
+	defer func() { HttpClient = client }()
+	HttpClient = httpDoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"code":0,"uid":"sdk-1"}`))}, nil
+	})
+	a := &HttpAuthenticator{
+		Request: func(args Args) (*http.Request, error) {
+			return http.NewRequest(http.MethodPost, "http://sdk.test/verify", nil)
+		},
+		Response: func(args Args, body []byte) (*Result, error) {
+			v := struct {
+				Code int    `json:"code"`
+				Uid  string `json:"uid"`
+			}{}
+			if err := json.Unmarshal(body, &v); err != nil {
+				return nil, err
+			}
+			if v.Code != 0 {
+				return nil, fmt.Errorf("sdk code:%d", v.Code)
+			}
+			return &Result{Openid: v.Uid}, nil
+		},
+	}
+	r, err := a.Authenticate(&ArgsDefault{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Openid != "sdk-1" {
+		t.Fatalf("openid:%s", r.Openid)
+	}
+}
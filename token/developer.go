@@ -0,0 +1,174 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	gwerrors "github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// DeveloperDefaultName 使用 gwcfg.Options.Developer 共用秘钥登录时的开发者名称,兼容旧版本 dev=1
+const DeveloperDefaultName = "1"
+
+// DeveloperFailureMax 同一IP在 DeveloperFailureWindow 内GM秘钥错误次数上限,超出后拒绝GM登录
+var DeveloperFailureMax = 5
+var DeveloperFailureWindow = 10 * time.Minute
+
+var errDeveloperSecret = fmt.Errorf("GM commands error")
+var errDeveloperLocked = fmt.Errorf("GM commands locked,try again later")
+
+// DeveloperVerify 验证GM秘钥,返回开发者账号,ip 用于限制错误次数和 Allow 检查,为空时拒绝
+func DeveloperVerify(secret, ip string) (*gwcfg.Developer, error) {
+	if gwcfg.Options.Developer == "" && len(gwcfg.Options.Developers) == 0 {
+		return nil, fmt.Errorf("GM commands are disabled")
+	}
+	if ip == "" {
+		logger.Alert("GM登录没有客户端地址,拒绝登录")
+		return nil, gwerrors.ErrAddressDenied
+	}
+	if !gwcfg.IPFilter.Developer(ip) {
+		logger.Alert("GM登录IP不在允许范围,IP:%s", ip)
+		return nil, gwerrors.ErrAddressDenied
+	}
+	if developerFailures.locked(ip) {
+		return nil, errDeveloperLocked
+	}
+	d := developerMatch(secret)
+	if d == nil {
+		n := developerFailures.add(ip)
+		logger.Alert("GM秘钥错误,IP:%s 次数:%d", ip, n)
+		return nil, errDeveloperSecret
+	}
+	if d.Expire > 0 && d.Expire <= time.Now().Unix() {
+		logger.Alert("开发者账号已过期,NAME:%s IP:%s", d.Name, ip)
+		return nil, fmt.Errorf("developer expired")
+	}
+	if !developerAllow(d, ip) {
+		logger.Alert("开发者登录IP不在允许范围,NAME:%s IP:%s", d.Name, ip)
+		return nil, fmt.Errorf("developer address not allowed")
+	}
+	developerFailures.reset(ip)
+	return d, nil
+}
+
+// developerMatch 常量时间比较所有秘钥,不提前返回
+func developerMatch(secret string) (r *gwcfg.Developer) {
+	if secret == "" {
+		return nil
+	}
+	if s := gwcfg.Options.Developer; s != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s)) == 1 {
+		r = &gwcfg.Developer{Name: DeveloperDefaultName}
+	}
+	sum := sha256.Sum256([]byte(secret))
+	for _, d := range gwcfg.Options.Developers {
+		h, err := hex.DecodeString(d.Secret)
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare(sum[:], h) == 1 && r == nil {
+			r = d
+		}
+	}
+	return
+}
+
+func developerAllow(d *gwcfg.Developer, ip string) bool {
+	if len(d.Allow) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, s := range d.Allow {
+		if _, n, err := net.ParseCIDR(s); err == nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// developerCheck 检查配置,Reload 时调用
+func developerCheck(ds []*gwcfg.Developer) error {
+	names := map[string]struct{}{}
+	for _, d := range ds {
+		if d.Name == "" {
+			return fmt.Errorf("developers name empty")
+		}
+		if _, ok := names[d.Name]; ok {
+			return fmt.Errorf("developers name duplicate:%s", d.Name)
+		}
+		names[d.Name] = struct{}{}
+		if b, err := hex.DecodeString(d.Secret); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("developers secret must be sha256 hex,name:%s", d.Name)
+		}
+		for _, s := range d.Allow {
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return fmt.Errorf("developers allow error,name:%s,%v", d.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+var developerFailures = &failures{dict: map[string]*failure{}}
+
+type failure struct {
+	count int
+	start time.Time
+}
+
+// failures 按IP记录GM秘钥错误次数
+type failures struct {
+	dict   map[string]*failure
+	locker sync.Mutex
+}
+
+func (f *failures) get(ip string, now time.Time) *failure {
+	v := f.dict[ip]
+	if v != nil && now.Sub(v.start) >= DeveloperFailureWindow {
+		delete(f.dict, ip)
+		v = nil
+	}
+	return v
+}
+
+func (f *failures) locked(ip string) bool {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+	v := f.get(ip, time.Now())
+	return v != nil && v.count >= DeveloperFailureMax
+}
+
+func (f *failures) add(ip string) int {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+	now := time.Now()
+	v := f.get(ip, now)
+	if v == nil {
+		if len(f.dict) >= 10000 {
+			for k, o := range f.dict {
+				if now.Sub(o.start) >= DeveloperFailureWindow {
+					delete(f.dict, k)
+				}
+			}
+		}
+		v = &failure{start: now}
+		f.dict[ip] = v
+	}
+	v.count++
+	return v.count
+}
+
+func (f *failures) reset(ip string) {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+	delete(f.dict, ip)
+}
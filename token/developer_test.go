@@ -0,0 +1,107 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestVerifyDeveloper(t *testing.T) {
+	developer, developers := gwcfg.Options.Developer, gwcfg.Options.Developers
+	defer func() {
+		gwcfg.Options.Developer, gwcfg.Options.Developers = developer, developers
+	}()
+	sum := sha256.Sum256([]byte("alice-secret"))
+	gwcfg.Options.Developer = "shared"
+	gwcfg.Options.Developers = []*gwcfg.Developer{{Name: "alice", Secret: hex.EncodeToString(sum[:]), Allow: []string{"10.0.0.0/8"}, Role: "qa"}}
+	cases := []struct {
+		name   string
+		secret string
+		ip     string
+		master string
+		ok     bool
+	}{
+		{"named", "alice-secret", "10.1.2.3", "alice", true},
+		{"named address denied", "alice-secret", "8.8.8.8", "", false},
+		{"shared", "shared", "8.8.8.8", DeveloperDefaultName, true},
+		{"wrong secret", "wrong", "9.9.9.9", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := VerifyWithIP(&ArgsDefault{Guid: "dev-user", Secret: c.secret}, c.ip)
+			if c.ok != (err == nil) {
+				t.Fatalf("ok:%v err:%v", c.ok, err)
+			}
+			if c.ok && (!r.Developer || r.Master != c.master || r.Openid != "dev-user") {
+				t.Fatalf("result:%+v", r)
+			}
+		})
+	}
+}
+
+// 认证方式通过 ArgsAddressOf 获取 VerifyWithIP 传入的地址
+func TestAuthenticatorAddress(t *testing.T) {
+	var address string
+	Authenticators.Register("test-address", AuthenticatorFunc(func(args Args) (*Result, error) {
+		address = ArgsAddressOf(args)
+		return &Result{Openid: "guest-" + args.GetAccess()}, nil
+	}))
+	r, err := VerifyWithIP(&ArgsDefault{Type: "test-address", Access: "device"}, "1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Openid != "guest-device" || address != "1.2.3.4" {
+		t.Fatalf("openid:%s address:%s", r.Openid, address)
+	}
+	if _, err = Verify(&ArgsDefault{Type: "not-exist"}); err == nil {
+		t.Fatal("unknown authenticator should fail")
+	}
+}
+
+// customArgs 自定义 Setting.C2SOAuthArgs,没有实现 ArgsAddress
+type customArgs struct {
+	Guid   string
+	Secret string
+}
+
+func (a *customArgs) GetGuid() string          { return a.Guid }
+func (a *customArgs) GetAccess() string        { return "" }
+func (a *customArgs) GetSecret() string        { return a.Secret }
+func (a *customArgs) GetValues() values.Values { return nil }
+
+// 自定义参数同样使用 VerifyWithIP 传入的地址检查开发者IP和错误次数
+func TestVerifyDeveloperCustomArgs(t *testing.T) {
+	developer, developers := gwcfg.Options.Developer, gwcfg.Options.Developers
+	defer func() {
+		gwcfg.Options.Developer, gwcfg.Options.Developers = developer, developers
+		developerFailures = &failures{dict: map[string]*failure{}}
+	}()
+	developerFailures = &failures{dict: map[string]*failure{}}
+	sum := sha256.Sum256([]byte("alice-secret"))
+	gwcfg.Options.Developer = ""
+	gwcfg.Options.Developers = []*gwcfg.Developer{{Name: "alice", Secret: hex.EncodeToString(sum[:]), Allow: []string{"10.0.0.0/8"}}}
+	r, err := VerifyWithIP(&customArgs{Guid: "dev-user", Secret: "alice-secret"}, "10.1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Master != "alice" {
+		t.Fatalf("master:%s", r.Master)
+	}
+	// 同一个IP错误次数超出后锁定,不影响其他IP
+	for i := 0; i < DeveloperFailureMax; i++ {
+		_, _ = VerifyWithIP(&customArgs{Guid: "dev-user", Secret: "wrong"}, "10.9.9.9")
+	}
+	if _, err = VerifyWithIP(&customArgs{Guid: "dev-user", Secret: "alice-secret"}, "10.9.9.9"); err != errDeveloperLocked {
+		t.Fatalf("attacker ip not locked:%v", err)
+	}
+	if _, err = VerifyWithIP(&customArgs{Guid: "dev-user", Secret: "alice-secret"}, "10.1.2.3"); err != nil {
+		t.Fatalf("other ip locked:%v", err)
+	}
+	// 没有地址时拒绝
+	if _, err = Verify(&customArgs{Guid: "dev-user", Secret: "alice-secret"}); err == nil {
+		t.Fatal("developer login without address should fail")
+	}
+}
@@ -0,0 +1,40 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hwcer/cosgo/utils"
+)
+
+// Issue 使用平台秘钥生成登录凭证(access),Verify 的逆过程
+// 平台服务,压测和本地测试直接调用,保证字段与 Verify 一致
+func Issue(r Result, secret string) (string, error) {
+	if secret == "" {
+		return "", fmt.Errorf("token secret is empty")
+	}
+	if r.Appid == "" {
+		return "", fmt.Errorf("token appid is empty")
+	}
+	if r.Openid == "" {
+		return "", fmt.Errorf("token openid is empty")
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return utils.Crypto.GCMEncrypt(string(b), secret, nil)
+}
+
+// IssueWithKey 使用带ID的秘钥生成登录凭证,对应 gwcfg.Options.Secrets
+func IssueWithKey(r Result, kid, secret string) (string, error) {
+	if kid == "" || strings.Contains(kid, KeySeparator) {
+		return "", fmt.Errorf("token key id error:%s", kid)
+	}
+	s, err := Issue(r, secret)
+	if err != nil {
+		return "", err
+	}
+	return kid + KeySeparator + s, nil
+}
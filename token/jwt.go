@@ -0,0 +1,247 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hwcer/cosgo/values"
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+// 登录凭证验证方式,gwcfg.Options.Verifier
+const (
+	VerifierGCM = "gcm" //平台秘钥对称加密,默认
+	VerifierJWT = "jwt" //平台私钥签名,网关使用公钥验证
+	VerifierAny = "any" //同时支持两种方式,按格式判断
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims 标准字段映射到 Result
+type jwtClaims struct {
+	Sub       string        `json:"sub"`
+	Aud       any           `json:"aud,omitempty"` //string 或者 []string
+	Exp       int64         `json:"exp,omitempty"`
+	Nbf       int64         `json:"nbf,omitempty"`
+	Iat       int64         `json:"iat,omitempty"`
+	Jti       string        `json:"jti,omitempty"`
+	Attach    values.Values `json:"attach,omitempty"`
+	Developer bool          `json:"developer,omitempty"`
+	Role      string        `json:"role,omitempty"`
+}
+
+// appid aud 中第一个允许登录的 appid,没有时为空
+func (c *jwtClaims) appid() string {
+	switch v := c.Aud.(type) {
+	case string:
+		if appidAllow(v) {
+			return v
+		}
+	case []any:
+		for _, i := range v {
+			if s, _ := i.(string); appidAllow(s) {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+func parsePublicKey(k *gwcfg.PublicKey) (*publicKey, error) {
+	data := []byte(k.Key)
+	if k.Key == "" && k.File != "" {
+		var err error
+		if data, err = os.ReadFile(k.File); err != nil {
+			return nil, err
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("publickeys pem error,id:%s", k.Id)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k.Alg {
+	case AlgEdDSA:
+		if _, ok := pub.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("publickeys not ed25519 key,id:%s", k.Id)
+		}
+	case AlgRS256:
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("publickeys not rsa key,id:%s", k.Id)
+		}
+	default:
+		return nil, fmt.Errorf("publickeys alg not support:%s", k.Alg)
+	}
+	return &publicKey{alg: k.Alg, key: pub}, nil
+}
+
+// verifier 签发凭证的 appid 使用的验证方式,没有配置时为 gcm
+func verifier(appid string) string {
+	if v := gwcfg.Options.Verifier[appid]; v != "" {
+		return v
+	}
+	return VerifierGCM
+}
+
+// verifierAllow 签发凭证的 appid 是否允许使用该格式的凭证
+func verifierAllow(appid string, jwt bool) bool {
+	switch verifier(appid) {
+	case VerifierAny:
+		return true
+	case VerifierJWT:
+		return jwt
+	case VerifierGCM:
+		return !jwt
+	}
+	return false
+}
+
+// appidAllow 凭证的 appid 是否允许登录,gwcfg.Options.Appid 以及 gwcfg.Options.Verifier 中配置的 appid
+func appidAllow(appid string) bool {
+	if appid == "" {
+		return false
+	}
+	if appid == gwcfg.Options.Appid {
+		return true
+	}
+	_, ok := gwcfg.Options.Verifier[appid]
+	return ok
+}
+
+// isJWT 是否 jwt 格式,三段 base64url
+func isJWT(access string) bool {
+	return strings.Count(access, ".") == 2
+}
+
+// parseJWT 验证签名并映射到 Result,过期,appid 和验证方式由 verifyAccess 统一判断
+func parseJWT(access string, r *Result) error {
+	parts := strings.Split(access, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("jwt format error")
+	}
+	header := &jwtHeader{}
+	if err := jwtDecode(parts[0], header); err != nil {
+		return err
+	}
+	ring, err := getKeyring()
+	if err != nil {
+		return err
+	}
+	k := ring.public[header.Kid]
+	if k == nil {
+		return fmt.Errorf("jwt kid unknown:%s", header.Kid)
+	}
+	if k.alg != header.Alg {
+		return fmt.Errorf("jwt alg error:%s", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch k.alg {
+	case AlgEdDSA:
+		if !ed25519.Verify(k.key.(ed25519.PublicKey), signed, sig) {
+			return fmt.Errorf("jwt signature error")
+		}
+	case AlgRS256:
+		h := sha256.Sum256(signed)
+		if err = rsa.VerifyPKCS1v15(k.key.(*rsa.PublicKey), crypto.SHA256, h[:], sig); err != nil {
+			return fmt.Errorf("jwt signature error")
+		}
+	}
+	claims := &jwtClaims{}
+	if err = jwtDecode(parts[1], claims); err != nil {
+		return err
+	}
+	if claims.Nbf > 0 && claims.Nbf > time.Now().Unix() {
+		return fmt.Errorf("jwt not valid yet")
+	}
+	r.Openid = claims.Sub
+	r.Expire = claims.Exp
+	r.Attach = claims.Attach
+	r.Developer = claims.Developer
+	r.Nonce = claims.Jti
+	r.Role = claims.Role
+	r.Appid = claims.appid()
+	return nil
+}
+
+func jwtDecode(s string, i any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, i)
+}
+
+func jwtEncode(i any) (string, error) {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign 使用私钥生成 jwt 登录凭证,支持 ed25519.PrivateKey 和 *rsa.PrivateKey
+// 平台服务一般使用自己的 jwt 库,这里主要用于压测和本地测试
+func Sign(r Result, kid string, key crypto.Signer) (string, error) {
+	header := jwtHeader{Kid: kid, Typ: "JWT"}
+	switch key.(type) {
+	case ed25519.PrivateKey:
+		header.Alg = AlgEdDSA
+	case *rsa.PrivateKey:
+		header.Alg = AlgRS256
+	default:
+		return "", fmt.Errorf("jwt private key not support:%T", key)
+	}
+	claims := jwtClaims{Sub: r.Openid, Aud: r.Appid, Exp: r.Expire, Iat: time.Now().Unix(), Jti: r.Nonce, Attach: r.Attach, Developer: r.Developer, Role: r.Role}
+	h, err := jwtEncode(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := jwtEncode(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := h + "." + c
+	var sig []byte
+	if header.Alg == AlgEdDSA {
+		sig, err = key.Sign(rand.Reader, []byte(signed), crypto.Hash(0))
+	} else {
+		d := sha256.Sum256([]byte(signed))
+		sig, err = key.Sign(rand.Reader, d[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
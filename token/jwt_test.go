@@ -0,0 +1,190 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func pemPublicKey(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+}
+
+// setupJWT 使用 jwt 验证方式,返回 ed25519 和 rsa 私钥
+func setupJWT(t *testing.T) (ed25519.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appid, verifier, publicKeys := gwcfg.Options.Appid, gwcfg.Options.Verifier, gwcfg.Options.PublicKeys
+	t.Cleanup(func() {
+		gwcfg.Options.Appid, gwcfg.Options.Verifier, gwcfg.Options.PublicKeys = appid, verifier, publicKeys
+		keys.Store(nil)
+	})
+	gwcfg.Options.Appid = "game"
+	gwcfg.Options.Verifier = map[string]string{"game": VerifierJWT}
+	gwcfg.Options.PublicKeys = []*gwcfg.PublicKey{
+		{Id: "ed", Alg: AlgEdDSA, Key: pemPublicKey(t, edPub)},
+		{Id: "rsa", Alg: AlgRS256, Key: pemPublicKey(t, &rsaKey.PublicKey)},
+	}
+	keys.Store(nil)
+	return edKey, rsaKey
+}
+
+func TestVerifyJWT(t *testing.T) {
+	edKey, rsaKey := setupJWT(t)
+	expire := time.Now().Add(time.Hour).Unix()
+	sign := func(r Result, kid string, key crypto.Signer) string {
+		s, err := Sign(r, kid, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tamper := func(s string) string {
+		parts := strings.Split(s, ".")
+		claims, _ := jwtEncode(jwtClaims{Sub: "admin", Aud: "game", Exp: expire})
+		return parts[0] + "." + claims + "." + parts[2]
+	}
+	cases := []struct {
+		name   string
+		access string
+		openid string
+		ok     bool
+	}{
+		{"ed25519", sign(Result{Appid: "game", Openid: "u1", Expire: expire}, "ed", edKey), "u1", true},
+		{"rs256", sign(Result{Appid: "game", Openid: "u2", Expire: expire}, "rsa", rsaKey), "u2", true},
+		{"no expire", sign(Result{Appid: "game", Openid: "u3"}, "ed", edKey), "u3", true},
+		{"unknown kid", sign(Result{Appid: "game", Openid: "u1", Expire: expire}, "none", edKey), "", false},
+		{"alg mismatch", sign(Result{Appid: "game", Openid: "u1", Expire: expire}, "ed", rsaKey), "", false},
+		{"tampered", tamper(sign(Result{Appid: "game", Openid: "u1", Expire: expire}, "ed", edKey)), "", false},
+		{"expired", sign(Result{Appid: "game", Openid: "u1", Expire: time.Now().Add(-time.Minute).Unix()}, "ed", edKey), "", false},
+		{"audience", sign(Result{Appid: "other", Openid: "u1", Expire: expire}, "ed", edKey), "", false},
+		{"empty sub", sign(Result{Appid: "game", Expire: expire}, "ed", edKey), "", false},
+		{"gcm access", "abcdef", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := verifyAccess(&ArgsDefault{Access: c.access})
+			if c.ok != (err == nil) {
+				t.Fatalf("ok:%v err:%v", c.ok, err)
+			}
+			if c.ok && r.Openid != c.openid {
+				t.Fatalf("openid:%s want:%s", r.Openid, c.openid)
+			}
+		})
+	}
+}
+
+func TestParseJWTClaims(t *testing.T) {
+	edKey, _ := setupJWT(t)
+	h, _ := jwtEncode(jwtHeader{Alg: AlgEdDSA, Kid: "ed"})
+	build := func(claims jwtClaims) string {
+		c, _ := jwtEncode(claims)
+		signed := h + "." + c
+		return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(edKey, []byte(signed)))
+	}
+	// aud 为数组
+	r := &Result{}
+	if err := parseJWT(build(jwtClaims{Sub: "u1", Aud: []string{"other", "game"}, Jti: "n1"}), r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Appid != "game" || r.Openid != "u1" || r.Nonce != "n1" {
+		t.Fatalf("result:%+v", r)
+	}
+	// nbf 未到
+	if err := parseJWT(build(jwtClaims{Sub: "u1", Aud: "game", Nbf: time.Now().Add(time.Hour).Unix()}), &Result{}); err == nil {
+		t.Fatal("nbf in the future should fail")
+	}
+}
+
+// 按凭证中的 appid 选择验证方式
+func TestVerifierAppid(t *testing.T) {
+	edKey, _ := setupJWT(t)
+	secret := gwcfg.Options.Secret
+	t.Cleanup(func() { gwcfg.Options.Secret = secret })
+	gwcfg.Options.Secret = "secret"
+	gwcfg.Options.Verifier = map[string]string{"game": VerifierJWT, "h5": VerifierAny, "legacy": VerifierGCM}
+	jwt := func(appid string) string {
+		s, err := Sign(Result{Appid: appid, Openid: "u1"}, "ed", edKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	gcm := func(appid string) string {
+		s, err := Issue(Result{Appid: appid, Openid: "u1"}, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	cases := []struct {
+		name   string
+		access string
+		appid  string
+		ok     bool
+	}{
+		{"game jwt", jwt("game"), "game", true},
+		{"game gcm", gcm("game"), "", false},
+		{"h5 jwt", jwt("h5"), "h5", true},
+		{"h5 gcm", gcm("h5"), "h5", true},
+		{"legacy jwt", jwt("legacy"), "", false},
+		{"legacy gcm", gcm("legacy"), "legacy", true},
+		{"unknown gcm", gcm("unknown"), "", false},
+		{"unknown jwt", jwt("unknown"), "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := verifyAccess(&ArgsDefault{Access: c.access})
+			if c.ok != (err == nil) {
+				t.Fatalf("ok:%v err:%v", c.ok, err)
+			}
+			if c.ok && r.Appid != c.appid {
+				t.Fatalf("appid:%s want:%s", r.Appid, c.appid)
+			}
+		})
+	}
+}
+
+func TestVerifierReload(t *testing.T) {
+	setupJWT(t)
+	gwcfg.Options.Verifier = map[string]string{"game": "rsa"}
+	if err := Reload(); err == nil {
+		t.Fatal("unknown verifier should fail")
+	}
+}
+
+func TestJWTRole(t *testing.T) {
+	edKey, _ := setupJWT(t)
+	access, err := Sign(Result{Appid: "game", Openid: "u1", Role: "gm"}, "ed", edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := verifyAccess(&ArgsDefault{Access: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Role != "gm" {
+		t.Fatalf("role:%q", r.Role)
+	}
+}
@@ -0,0 +1,135 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hwcer/cosgo/utils"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// KeySeparator access 中秘钥ID与密文的分隔符,没有分隔符的为旧版本 access
+const KeySeparator = ":"
+
+var keys atomic.Pointer[keyring]
+
+type keyring struct {
+	dict   map[string]*gwcfg.SecretKey
+	list   []*gwcfg.SecretKey
+	public map[string]*publicKey //jwt 公钥
+}
+
+// Reload 使用 gwcfg.Options 重建秘钥环和防重放记录方式,整体替换不影响正在验证的请求
+// gwcfg.Options.Secret 作为ID为空的秘钥,始终有效; gwcfg.Options.PublicKeys 用于 jwt 验证
+// 同时检查 gwcfg.Options.Developers 配置
+func Reload() error {
+	apply, err := Prepare(&gwcfg.Options)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// Prepare 检查 opts 中的凭证配置并创建秘钥环和防重放记录方式,返回的函数用于生效
+// Module.Reload 检查所有配置之后再统一生效,失败时保留原配置
+func Prepare(opts *gwcfg.Config) (func(), error) {
+	if err := developerCheck(opts.Developers); err != nil {
+		return nil, err
+	}
+	for appid, v := range opts.Verifier {
+		if v != VerifierGCM && v != VerifierJWT && v != VerifierAny {
+			return nil, fmt.Errorf("verifier not support,appid:%s verifier:%s", appid, v)
+		}
+	}
+	r := &keyring{dict: map[string]*gwcfg.SecretKey{}, public: map[string]*publicKey{}}
+	if opts.Secret != "" {
+		r.add(&gwcfg.SecretKey{Secret: opts.Secret})
+	}
+	for _, k := range opts.Secrets {
+		if k.Id == "" || strings.Contains(k.Id, KeySeparator) {
+			return nil, fmt.Errorf("secrets id error:%s", k.Id)
+		}
+		if k.Secret == "" {
+			return nil, fmt.Errorf("secrets secret empty,id:%s", k.Id)
+		}
+		if _, ok := r.dict[k.Id]; ok {
+			return nil, fmt.Errorf("secrets id duplicate:%s", k.Id)
+		}
+		r.add(k)
+	}
+	for _, k := range opts.PublicKeys {
+		if _, ok := r.public[k.Id]; ok {
+			return nil, fmt.Errorf("publickeys id duplicate:%s", k.Id)
+		}
+		pub, err := parsePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		r.public[k.Id] = pub
+	}
+	var redis string
+	if opts.Gate != nil {
+		redis = opts.Gate.Redis
+	}
+	replay, err := prepareReplay(opts.Replay, redis)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		keys.Store(r)
+		replay()
+	}, nil
+}
+
+func (r *keyring) add(k *gwcfg.SecretKey) {
+	r.dict[k.Id] = k
+	r.list = append(r.list, k)
+}
+
+// getKeyring 没有调用 Reload 时使用当前配置创建,配置错误时返回错误,下次继续尝试
+func getKeyring() (*keyring, error) {
+	if r := keys.Load(); r != nil {
+		return r, nil
+	}
+	if err := Reload(); err != nil {
+		logger.Alert("秘钥配置错误:%v", err)
+		return nil, fmt.Errorf("keyring reload error:%w", err)
+	}
+	return keys.Load(), nil
+}
+
+// decrypt 按秘钥ID解密,旧版本 access 没有秘钥ID,依次尝试所有有效秘钥
+func decrypt(access string) (s string, err error) {
+	r, err := getKeyring()
+	if err != nil {
+		return "", err
+	}
+	if len(r.list) == 0 {
+		return "", fmt.Errorf("Options.Secret is empty")
+	}
+	now := time.Now().Unix()
+	if kid, data, ok := strings.Cut(access, KeySeparator); ok {
+		k := r.dict[kid]
+		if k == nil {
+			return "", fmt.Errorf("access key id unknown:%s", kid)
+		}
+		if !k.Active(now) {
+			return "", fmt.Errorf("access key id inactive:%s", kid)
+		}
+		return utils.Crypto.GCMDecrypt(data, k.Secret, nil)
+	}
+	err = fmt.Errorf("access key not found")
+	for _, k := range r.list {
+		if !k.Active(now) {
+			continue
+		}
+		if s, err = utils.Crypto.GCMDecrypt(access, k.Secret, nil); err == nil {
+			return
+		}
+	}
+	return "", err
+}
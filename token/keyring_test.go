@@ -0,0 +1,193 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestKeyringReloadError(t *testing.T) {
+	secret, secrets := gwcfg.Options.Secret, gwcfg.Options.Secrets
+	defer func() {
+		gwcfg.Options.Secret, gwcfg.Options.Secrets = secret, secrets
+		keys.Store(nil)
+	}()
+	keys.Store(nil)
+	gwcfg.Options.Secret = "secret"
+	gwcfg.Options.Secrets = []*gwcfg.SecretKey{{Id: "k1", Secret: "a"}, {Id: "k1", Secret: "b"}}
+	if _, err := getKeyring(); err == nil {
+		t.Fatal("duplicate secrets id should fail")
+	}
+	if _, err := decrypt("k1:xxx"); err == nil {
+		t.Fatal("decrypt with broken keyring should fail")
+	}
+	if keys.Load() != nil {
+		t.Fatal("broken keyring should not be cached")
+	}
+	// 修复配置后重新加载
+	gwcfg.Options.Secrets = []*gwcfg.SecretKey{{Id: "k1", Secret: "a"}}
+	r, err := getKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.list) != 2 || r.dict["k1"] == nil {
+		t.Fatalf("keyring list:%d", len(r.list))
+	}
+}
+
+// setupKeyring 使用 legacy 作为 gwcfg.Options.Secret,secrets 作为带ID的秘钥
+func setupKeyring(t *testing.T, secrets ...*gwcfg.SecretKey) {
+	t.Helper()
+	appid, secret, old := gwcfg.Options.Appid, gwcfg.Options.Secret, gwcfg.Options.Secrets
+	t.Cleanup(func() {
+		gwcfg.Options.Appid, gwcfg.Options.Secret, gwcfg.Options.Secrets = appid, secret, old
+		keys.Store(nil)
+	})
+	gwcfg.Options.Appid = "app"
+	gwcfg.Options.Secret = "legacy"
+	gwcfg.Options.Secrets = secrets
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyringKid(t *testing.T) {
+	setupKeyring(t, &gwcfg.SecretKey{Id: "k1", Secret: "s1"}, &gwcfg.SecretKey{Id: "k2", Secret: "s2"})
+	r := Result{Appid: "app", Openid: "u1"}
+	cases := []struct {
+		name   string
+		kid    string
+		secret string
+		ok     bool
+	}{
+		{"k1", "k1", "s1", true},
+		{"k2", "k2", "s2", true},
+		{"wrong secret", "k1", "s2", false}, //按ID选择秘钥,不尝试其他秘钥
+		{"unknown kid", "k9", "s1", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			access, err := IssueWithKey(r, c.kid, c.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = decrypt(access); (err == nil) != c.ok {
+				t.Fatalf("decrypt err:%v want ok:%v", err, c.ok)
+			}
+		})
+	}
+}
+
+func TestKeyringLegacy(t *testing.T) {
+	setupKeyring(t, &gwcfg.SecretKey{Id: "k1", Secret: "s1"})
+	r := Result{Appid: "app", Openid: "u1"}
+	cases := []struct {
+		secret string
+		ok     bool
+	}{
+		{"legacy", true},
+		{"s1", true}, //没有秘钥ID时依次尝试所有秘钥
+		{"other", false},
+	}
+	for _, c := range cases {
+		access, err := Issue(r, c.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decrypt(access); (err == nil) != c.ok {
+			t.Fatalf("secret %s decrypt err:%v want ok:%v", c.secret, err, c.ok)
+		}
+	}
+}
+
+func TestKeyringActive(t *testing.T) {
+	now := time.Now().Unix()
+	setupKeyring(t,
+		&gwcfg.SecretKey{Id: "future", Secret: "s1", Start: now + 3600},
+		&gwcfg.SecretKey{Id: "expired", Secret: "s2", Expire: now - 1},
+		&gwcfg.SecretKey{Id: "active", Secret: "s3", Start: now - 3600, Expire: now + 3600},
+	)
+	r := Result{Appid: "app", Openid: "u1"}
+	cases := []struct {
+		kid    string
+		secret string
+		ok     bool
+	}{
+		{"future", "s1", false},
+		{"expired", "s2", false},
+		{"active", "s3", true},
+	}
+	for _, c := range cases {
+		access, err := IssueWithKey(r, c.kid, c.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decrypt(access); (err == nil) != c.ok {
+			t.Fatalf("kid %s decrypt err:%v want ok:%v", c.kid, err, c.ok)
+		}
+		// 没有秘钥ID的旧版本 access 同样跳过不在有效期内的秘钥
+		if access, err = Issue(r, c.secret); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decrypt(access); (err == nil) != c.ok {
+			t.Fatalf("legacy %s decrypt err:%v want ok:%v", c.kid, err, c.ok)
+		}
+	}
+}
+
+func TestIssueWithKey(t *testing.T) {
+	setupKeyring(t, &gwcfg.SecretKey{Id: "k1", Secret: "s1"})
+	for _, kid := range []string{"", "a:b"} {
+		if _, err := IssueWithKey(Result{Appid: "app", Openid: "u1"}, kid, "s1"); err == nil {
+			t.Fatalf("kid %q should fail", kid)
+		}
+	}
+	access, err := IssueWithKey(Result{Appid: "app", Openid: "u1", Role: "gm"}, "k1", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := verifyAccess(&ArgsDefault{Access: access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Openid != "u1" || r.Appid != "app" || r.Role != "gm" {
+		t.Fatalf("result:%+v", r)
+	}
+	// 其他 appid 的凭证
+	if access, err = IssueWithKey(Result{Appid: "other", Openid: "u1"}, "k1", "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = verifyAccess(&ArgsDefault{Access: access}); err == nil {
+		t.Fatal("appid mismatch should fail")
+	}
+}
+
+// Prepare 检查失败时不替换秘钥环和防重放记录方式
+func TestPrepare(t *testing.T) {
+	setupKeyring(t)
+	r, cache := keys.Load(), replayCache
+	t.Cleanup(func() { SetReplayCache(cache) })
+	opts, err := gwcfg.Options.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Secret = "new"
+	opts.Replay = &gwcfg.Replay{Policy: gwcfg.ReplayPolicyStrict, Capacity: 10}
+	opts.Secrets = []*gwcfg.SecretKey{{Id: "k1"}}
+	if _, err = Prepare(opts); err == nil {
+		t.Fatal("empty secret should fail")
+	}
+	opts.Secrets = nil
+	apply, err := Prepare(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Load() != r || replayCache != cache {
+		t.Fatal("prepare should not apply")
+	}
+	apply()
+	if keys.Load().dict[""].Secret != "new" || replayCache == cache {
+		t.Fatal("apply should replace keyring and replay cache")
+	}
+}
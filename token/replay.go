@@ -0,0 +1,225 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	gwerrors "github.com/hwcer/gateway/errors"
+	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
+)
+
+// ReplayCache 记录已经使用过的登录凭证
+type ReplayCache interface {
+	// Use 记录凭证使用,first 是否第一次使用,origin 第一次使用时的IP
+	Use(key, ip string, ttl time.Duration) (first bool, origin string, err error)
+}
+
+var replayCache ReplayCache
+var replaySource string //Reload 创建的记录方式,redis 地址或者内存容量,SetReplayCache 时为空
+var replayLocker sync.RWMutex
+
+// SetReplayCache 设置防重放记录方式,一般由 Reload 根据配置设置
+func SetReplayCache(c ReplayCache) {
+	replayLocker.Lock()
+	defer replayLocker.Unlock()
+	replayCache = c
+	replaySource = ""
+}
+
+// prepareReplay 开启防重放时按配置创建记录方式,redis 不为空时使用 redis,否则使用内存
+// 配置没有变化时保留原来的记录,返回的函数用于生效
+func prepareReplay(opts *gwcfg.Replay, redisAddress string) (func(), error) {
+	if opts == nil || opts.Policy == gwcfg.ReplayPolicyNone {
+		return func() {}, nil
+	}
+	source := "memory:" + strconv.Itoa(opts.Capacity)
+	if redisAddress != "" {
+		source = "redis:" + redisAddress
+	}
+	replayLocker.RLock()
+	same := replayCache != nil && replaySource == source
+	replayLocker.RUnlock()
+	if same {
+		return func() {}, nil
+	}
+	var c ReplayCache
+	if redisAddress != "" {
+		var err error
+		if c, err = NewReplayRedis(redisAddress); err != nil {
+			return nil, err
+		}
+	} else {
+		c = NewReplayMemory(opts.Capacity)
+	}
+	return func() {
+		replayLocker.Lock()
+		defer replayLocker.Unlock()
+		replayCache = c
+		replaySource = source
+	}, nil
+}
+
+func getReplayCache() ReplayCache {
+	replayLocker.RLock()
+	c := replayCache
+	replayLocker.RUnlock()
+	if c != nil {
+		return c
+	}
+	replayLocker.Lock()
+	defer replayLocker.Unlock()
+	if replayCache == nil {
+		replayCache = NewReplayMemory(gwcfg.Options.Replay.Capacity)
+	}
+	return replayCache
+}
+
+// verifyReplay 检查登录凭证是否重复使用,没有 nonce 的凭证不检查
+func verifyReplay(r *Result, ip string) error {
+	opts := gwcfg.Options.Replay
+	if opts == nil || opts.Policy == gwcfg.ReplayPolicyNone || r.Nonce == "" {
+		return nil
+	}
+	ttl := time.Duration(opts.Window) * time.Second
+	if r.Expire > 0 {
+		ttl = time.Until(time.Unix(r.Expire, 0))
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	key := strings.Join([]string{r.Appid, r.Openid, r.Nonce}, ":")
+	first, origin, err := getReplayCache().Use(key, ip, ttl)
+	if err != nil {
+		return err
+	}
+	if first {
+		return nil
+	}
+	if opts.Policy == gwcfg.ReplayPolicyIP && origin == ip {
+		return nil
+	}
+	logger.Alert("登录凭证重复使用,OPENID:%s IP:%s 首次使用IP:%s", r.Openid, ip, origin)
+	return gwerrors.ErrAccessReplay
+}
+
+// NewReplayMemory 内存记录,最多保存 capacity 条,超出时淘汰最早的记录
+func NewReplayMemory(capacity int) ReplayCache {
+	if capacity <= 0 {
+		capacity = 100000
+	}
+	return &replayMemory{capacity: capacity, dict: map[string]*replayEntry{}}
+}
+
+type replayEntry struct {
+	ip     string
+	expire time.Time
+}
+
+// replayItem 写入顺序,同一个 key 过期后再次使用时 entry 不同,旧的 replayItem 淘汰时跳过
+type replayItem struct {
+	key   string
+	entry *replayEntry
+}
+
+type replayMemory struct {
+	capacity int
+	dict     map[string]*replayEntry
+	queue    []replayItem //按写入顺序
+	locker   sync.Mutex
+}
+
+func (m *replayMemory) Use(key, ip string, ttl time.Duration) (bool, string, error) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	now := time.Now()
+	if e, ok := m.dict[key]; ok && now.Before(e.expire) {
+		return false, e.ip, nil
+	}
+	m.evict(now)
+	e := &replayEntry{ip: ip, expire: now.Add(ttl)}
+	m.dict[key] = e
+	m.queue = append(m.queue, replayItem{key: key, entry: e})
+	return true, ip, nil
+}
+
+// evict 清理队首过期记录,数量超出上限时强制淘汰,已经被重新写入的旧记录直接跳过
+func (m *replayMemory) evict(now time.Time) {
+	var i int
+	for ; i < len(m.queue); i++ {
+		item := m.queue[i]
+		e := m.dict[item.key]
+		if e != item.entry {
+			continue
+		}
+		if now.Before(e.expire) && len(m.dict) < m.capacity {
+			break
+		}
+		delete(m.dict, item.key)
+	}
+	if i > 0 {
+		m.queue = append(m.queue[:0], m.queue[i:]...)
+	}
+}
+
+// NewReplayRedis 使用 redis 记录,多个网关共享
+// address 格式: ip:port?db=1&password=123456 或者 redis://
+func NewReplayRedis(address string) (ReplayCache, error) {
+	opts, err := redisOptions(address)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err = client.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+	return &replayRedis{client: client}, nil
+}
+
+const replayRedisPrefix = "gateway:replay:"
+
+type replayRedis struct {
+	client *redis.Client
+}
+
+func (r *replayRedis) Use(key, ip string, ttl time.Duration) (bool, string, error) {
+	ctx := context.Background()
+	key = replayRedisPrefix + key
+	ok, err := r.client.SetNX(ctx, key, ip, ttl).Result()
+	if err != nil || ok {
+		return ok, ip, err
+	}
+	origin, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, "", nil //刚刚过期,按重复使用处理
+	}
+	return false, origin, err
+}
+
+func redisOptions(address string) (*redis.Options, error) {
+	if strings.Contains(address, "://") {
+		return redis.ParseURL(address)
+	}
+	opts := &redis.Options{Addr: address}
+	if i := strings.Index(address, "?"); i >= 0 {
+		opts.Addr = address[:i]
+		query, err := url.ParseQuery(address[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		opts.Password = query.Get("password")
+		if db := query.Get("db"); db != "" {
+			if opts.DB, err = strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("redis db error:%s", db)
+			}
+		}
+	}
+	return opts, nil
+}
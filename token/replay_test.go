@@ -0,0 +1,146 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hwcer/gateway/gwcfg"
+)
+
+func TestReplayMemory(t *testing.T) {
+	m := NewReplayMemory(2)
+	if first, _, _ := m.Use("a", "1.1.1.1", time.Minute); !first {
+		t.Fatal("first use")
+	}
+	if first, origin, _ := m.Use("a", "2.2.2.2", time.Minute); first || origin != "1.1.1.1" {
+		t.Fatalf("second use first:%v origin:%s", first, origin)
+	}
+	// 过期后可以再次使用
+	if first, _, _ := m.Use("b", "1.1.1.1", 10*time.Millisecond); !first {
+		t.Fatal("first use b")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if first, _, _ := m.Use("b", "1.1.1.1", time.Minute); !first {
+		t.Fatal("expired b should be usable")
+	}
+	// 超出容量淘汰最早的记录
+	m.Use("c", "1.1.1.1", time.Minute)
+	m.Use("d", "1.1.1.1", time.Minute)
+	if first, _, _ := m.Use("a", "1.1.1.1", time.Minute); !first {
+		t.Fatal("a should be evicted")
+	}
+	if n := len(m.(*replayMemory).dict); n > 2 {
+		t.Fatalf("capacity exceeded:%d", n)
+	}
+}
+
+// 过期后再次使用的 key 在队列中有两条记录,淘汰时按最新的记录处理
+func TestReplayMemoryReuse(t *testing.T) {
+	m := NewReplayMemory(3)
+	m.Use("x", "1.1.1.1", time.Minute)
+	m.Use("a", "1.1.1.1", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	m.Use("b", "1.1.1.1", time.Minute)
+	if first, _, _ := m.Use("a", "1.1.1.1", time.Minute); !first {
+		t.Fatal("expired a should be usable")
+	}
+	m.Use("c", "1.1.1.1", time.Minute) //淘汰 x
+	m.Use("d", "1.1.1.1", time.Minute) //淘汰 b,不能淘汰刚刚写入的 a
+	if first, _, _ := m.Use("a", "1.1.1.1", time.Minute); first {
+		t.Fatal("a evicted before older records")
+	}
+	if first, _, _ := m.Use("b", "1.1.1.1", time.Minute); !first {
+		t.Fatal("b should be evicted")
+	}
+}
+
+func TestReloadReplay(t *testing.T) {
+	replay, cache := gwcfg.Options.Replay, replayCache
+	defer func() {
+		gwcfg.Options.Replay = replay
+		SetReplayCache(cache)
+	}()
+	SetReplayCache(nil)
+	gwcfg.Options.Replay = &gwcfg.Replay{Policy: gwcfg.ReplayPolicyNone}
+	if err := Reload(); err != nil || replayCache != nil {
+		t.Fatalf("disabled replay cache:%v err:%v", replayCache, err)
+	}
+	// Reload 时开启
+	gwcfg.Options.Replay = &gwcfg.Replay{Policy: gwcfg.ReplayPolicyStrict, Capacity: 10}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	c, ok := replayCache.(*replayMemory)
+	if !ok || c.capacity != 10 {
+		t.Fatalf("replay cache:%v", replayCache)
+	}
+	// 配置没有变化时保留记录
+	if err := Reload(); err != nil || replayCache != c {
+		t.Fatalf("replay cache replaced err:%v", err)
+	}
+	gwcfg.Options.Replay.Capacity = 20
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok = replayCache.(*replayMemory); !ok || c.capacity != 20 {
+		t.Fatalf("replay cache:%v", replayCache)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	replay, cache := gwcfg.Options.Replay, replayCache
+	defer func() {
+		gwcfg.Options.Replay = replay
+		SetReplayCache(cache)
+	}()
+	type use struct {
+		ip string
+		ok bool
+	}
+	cases := []struct {
+		name   string
+		policy string
+		nonce  string
+		uses   []use
+	}{
+		{"none", gwcfg.ReplayPolicyNone, "n1", []use{{"1.1.1.1", true}, {"1.1.1.1", true}}},
+		{"no nonce", gwcfg.ReplayPolicyStrict, "", []use{{"1.1.1.1", true}, {"2.2.2.2", true}}},
+		{"strict", gwcfg.ReplayPolicyStrict, "n1", []use{{"1.1.1.1", true}, {"1.1.1.1", false}, {"2.2.2.2", false}}},
+		{"ip", gwcfg.ReplayPolicyIP, "n1", []use{{"1.1.1.1", true}, {"1.1.1.1", true}, {"2.2.2.2", false}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			gwcfg.Options.Replay = &gwcfg.Replay{Policy: c.policy, Window: 60}
+			SetReplayCache(NewReplayMemory(100))
+			r := &Result{Appid: "game", Openid: "u1", Nonce: c.nonce}
+			for i, u := range c.uses {
+				if err := verifyReplay(r, u.ip); (err == nil) != u.ok {
+					t.Fatalf("use %d ip:%s ok:%v err:%v", i, u.ip, u.ok, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisOptions(t *testing.T) {
+	cases := []struct {
+		address  string
+		addr     string
+		password string
+		db       int
+		ok       bool
+	}{
+		{"127.0.0.1:6379", "127.0.0.1:6379", "", 0, true},
+		{"127.0.0.1:6379?db=2&password=123", "127.0.0.1:6379", "123", 2, true},
+		{"127.0.0.1:6379?db=x", "", "", 0, false},
+	}
+	for _, c := range cases {
+		opts, err := redisOptions(c.address)
+		if c.ok != (err == nil) {
+			t.Fatalf("%s ok:%v err:%v", c.address, c.ok, err)
+		}
+		if c.ok && (opts.Addr != c.addr || opts.Password != c.password || opts.DB != c.db) {
+			t.Fatalf("%s options:%+v", c.address, opts)
+		}
+	}
+}
@@ -7,11 +7,10 @@ import (
 	"time"
 
 	"github.com/hwcer/cosgo/values"
-	"github.com/hwcer/gateway/errors"
 	"github.com/hwcer/gateway/gwcfg"
+	"github.com/hwcer/logger"
 
 	"github.com/hwcer/cosgo/session"
-	"github.com/hwcer/cosgo/utils"
 )
 
 type Args interface {
@@ -32,14 +31,55 @@ type Result struct {
 	Expire    int64         `json:"expire"`
 	Attach    values.Values `json:"attach"`
 	Developer bool          `json:"developer"`
+	Nonce     string        `json:"nonce,omitempty"` //凭证唯一ID,开启防重放时同一凭证只能使用一次
+	Role      string        `json:"role,omitempty"`  //角色
+	Master    string        `json:"-"`               //GM 登录时的开发者名称
+}
+
+// ArgsType 可选接口,选择认证方式
+type ArgsType interface {
+	GetType() string
+}
+
+// ArgsAddress 可选接口,VerifyWithIP 写入客户端地址,认证方式需要地址时应实现 AuthenticatorWithIP,不依赖参数类型
+type ArgsAddress interface {
+	GetAddress() string
+	SetAddress(ip string)
+}
+
+// ArgsAddressOf 客户端地址,参数没有实现 ArgsAddress 时为空
+func ArgsAddressOf(args Args) string {
+	if v, ok := args.(ArgsAddress); ok {
+		return v.GetAddress()
+	}
+	return ""
+}
+
+// ArgsReliable 可选接口,客户端是否使用可靠推送(序号确认和断线补发),网关开启 reliable.enable 时有效
+type ArgsReliable interface {
+	GetReliable() bool
+}
+
+// ArgsReliableOf 客户端是否使用可靠推送,参数没有实现 ArgsReliable 时为 false
+func ArgsReliableOf(args Args) bool {
+	if v, ok := args.(ArgsReliable); ok {
+		return v.GetReliable()
+	}
+	return false
 }
 
 type ArgsDefault struct {
-	Guid   string `json:"guid"`
-	Access string `json:"access"`
-	Secret string `json:"secret"`
+	Type     string `json:"type"` //认证方式,为空时使用默认方式
+	Guid     string `json:"guid"`
+	Access   string `json:"access"`
+	Secret   string `json:"secret"`
+	Address  string `json:"-"`                  //客户端地址,由 VerifyWithIP 写入
+	Reliable bool   `json:"reliable,omitempty"` //客户端使用可靠推送
 }
 
+func (t *ArgsDefault) GetType() string {
+	return t.Type
+}
 func (t *ArgsDefault) GetGuid() string {
 	return t.Guid
 }
@@ -52,40 +92,93 @@ func (t *ArgsDefault) GetSecret() string {
 func (t *ArgsDefault) GetValues() values.Values {
 	return nil
 }
+func (t *ArgsDefault) GetAddress() string {
+	return t.Address
+}
+func (t *ArgsDefault) SetAddress(ip string) {
+	t.Address = ip
+}
+func (t *ArgsDefault) GetReliable() bool {
+	return t.Reliable
+}
 
+// Verify 按参数选择认证方式,验证登录信息
+// 参数实现 ArgsType 时使用 GetType 选择 Authenticators 中的认证方式,
+// 否则有 secret 时使用 AuthenticatorDeveloper,没有时使用 AuthenticatorAccess
 func Verify(args Args) (r *Result, err error) {
-	r = &Result{}
-	//是否开启 GM
-	if secret := args.GetSecret(); secret != "" {
-		if gwcfg.Options.Developer == "" {
-			return nil, fmt.Errorf("GM commands are disabled")
-		}
-		if secret != gwcfg.Options.Developer {
-			return nil, fmt.Errorf("GM commands error")
+	return VerifyWithIP(args, "")
+}
+
+// VerifyWithIP 与 Verify 相同,ip 客户端地址,用于防重放检查和开发者IP限制
+func VerifyWithIP(args Args, ip string) (r *Result, err error) {
+	name := authenticatorType(args)
+	a := Authenticators.Get(name)
+	if a == nil {
+		return nil, fmt.Errorf("authenticator not found:%s", name)
+	}
+	if v, ok := args.(ArgsAddress); ok {
+		v.SetAddress(ip)
+	}
+	if f, ok := a.(AuthenticatorWithIP); ok {
+		r, err = f.AuthenticateWithIP(args, ip)
+	} else {
+		r, err = a.Authenticate(args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || r.Openid == "" {
+		return nil, session.Errorf("access guid empty")
+	}
+	if !r.Developer {
+		if err = gwcfg.Maintain.Verify(r.Openid, ip); err != nil {
+			return nil, err
 		}
-		r.Developer = true
 	}
-	//GM 模式允许快速登录
-	if guid := args.GetGuid(); guid != "" && r.Developer {
-		if err = validateAccountComprehensive(guid); err != nil {
-			return
+	if err = verifyReplay(r, ip); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// verifyDeveloper GM 快速登录,没有 guid 时使用 access 登录并获得开发者身份
+func verifyDeveloper(args Args, ip string) (r *Result, err error) {
+	var d *gwcfg.Developer
+	if d, err = DeveloperVerify(args.GetSecret(), ip); err != nil {
+		return nil, err
+	}
+	if guid := args.GetGuid(); guid == "" {
+		if r, err = verifyAccess(args); err != nil {
+			return nil, err
 		}
-		r.Openid = guid
-		return
+	} else if err = validateAccountComprehensive(guid); err != nil {
+		return nil, err
+	} else {
+		r = &Result{Openid: guid}
 	}
-	//正常游戏模式
+	r.Developer = true
+	r.Master = d.Name
+	if d.Role != "" {
+		r.Role = d.Role
+	}
+	logger.Trace("开发者登录,NAME:%s OPENID:%s IP:%s", d.Name, r.Openid, ip)
+	return r, nil
+}
+
+// verifyAccess 正常游戏模式,验证平台下发的登录凭证
+func verifyAccess(args Args) (r *Result, err error) {
+	r = &Result{}
 	access := args.GetAccess()
 	if access == "" {
 		return nil, session.ErrorSessionEmpty
 	}
-	if gwcfg.Options.Secret == "" {
-		return nil, session.Errorf("Options.Secret is empty")
-	}
-	var s string
-	if s, err = utils.Crypto.GCMDecrypt(access, gwcfg.Options.Secret, nil); err != nil {
-		return nil, session.Errorf(err)
+	jwt := isJWT(access)
+	if jwt {
+		err = parseJWT(access, r)
+	} else {
+		err = parseGCM(access, r)
 	}
-	if err = json.Unmarshal([]byte(s), r); err != nil {
+	if err != nil {
 		return nil, session.Errorf(err)
 	}
 	if r.Openid == "" {
@@ -94,15 +187,23 @@ func Verify(args Args) (r *Result, err error) {
 	if r.Expire > 0 && r.Expire < time.Now().Unix() {
 		return nil, session.ErrorSessionExpired
 	}
-	if r.Appid != gwcfg.Options.Appid {
+	if !appidAllow(r.Appid) {
 		return nil, session.Errorf("access appid error")
 	}
-	if gwcfg.Options.Maintenance && !r.Developer {
-		return nil, errors.ErrServerMaintenance
+	if !verifierAllow(r.Appid, jwt) {
+		return nil, session.Errorf(fmt.Errorf("access verifier not allow,appid:%s verifier:%s", r.Appid, verifier(r.Appid)))
 	}
 	return
 }
 
+func parseGCM(access string, r *Result) error {
+	s, err := decrypt(access)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(s), r)
+}
+
 var accountPattern = regexp.MustCompile(`^[a-zA-Z0-9~!@#$%^&*()_+\-=\[\]\\{}|;':",./<>?]{2,64}$`)
 
 func validateAccountComprehensive(account string) error {
@@ -111,3 +212,15 @@ func validateAccountComprehensive(account string) error {
 	}
 	return nil
 }
+
+// DeveloperName 写入 session ServiceMetadataDeveloper 的值,非开发者为空
+// 平台凭证中 developer=true 没有开发者名称,使用 DeveloperDefaultName
+func (r *Result) DeveloperName() string {
+	if !r.Developer {
+		return ""
+	}
+	if r.Master != "" {
+		return r.Master
+	}
+	return DeveloperDefaultName
+}